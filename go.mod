@@ -20,6 +20,7 @@ require (
 	github.com/rancher/rancher/pkg/client v0.0.0-20210222182625-a85f4d1f87fe
 	github.com/rancher/steve v0.0.0-20210318171316-376934558c5b
 	github.com/rancher/wrangler v0.7.3-0.20210407025123-cf9bb4f55cee
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/sirupsen/logrus v1.6.0
 	github.com/urfave/cli v1.22.2
 	k8s.io/api v0.20.2
@@ -28,4 +29,5 @@ require (
 	k8s.io/client-go v12.0.0+incompatible
 	sigs.k8s.io/cluster-api v0.0.0
 	sigs.k8s.io/controller-runtime v0.8.2
+	sigs.k8s.io/yaml v1.2.0
 )
@@ -14,12 +14,15 @@ import (
 
 	"github.com/rancher/rancher-operator/pkg/controllers"
 	"github.com/rancher/rancher-operator/pkg/crd"
+	"github.com/rancher/rancher-operator/pkg/render"
 	"github.com/rancher/wrangler/pkg/kubeconfig"
 	"github.com/rancher/wrangler/pkg/signals"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 
 	_ "github.com/rancher/wrangler/pkg/generated/controllers/apiextensions.k8s.io/v1beta1"
+	// maintenance window time zones must resolve in images without a zoneinfo database
+	_ "time/tzdata"
 )
 
 var (
@@ -81,6 +84,16 @@ func main() {
 		},
 	}
 	app.Action = run
+	app.Commands = []cli.Command{
+		{
+			Name:      "render",
+			Usage:     "Print the objects and node plans generated for a Cluster without an API server",
+			ArgsUsage: "FILE...",
+			Description: "Reads a rancher.cattle.io/v1 Cluster and the Machines, Settings, Secrets and node configs it uses " +
+				"from the given YAML files and prints the generated objects followed by the decoded plan of every Machine.",
+			Action: renderCluster,
+		},
+	}
 
 	if err := app.Run(os.Args); err != nil {
 		logrus.Fatal(err)
@@ -113,3 +126,10 @@ func run(c *cli.Context) error {
 	<-ctx.Done()
 	return nil
 }
+
+func renderCluster(c *cli.Context) error {
+	if !c.Args().Present() {
+		return fmt.Errorf("at least one file is required")
+	}
+	return render.Render(context.Background(), c.Args(), os.Stdout)
+}
@@ -18,6 +18,47 @@ type RKENodePool struct {
 	DisplayName      string                       `json:"displayName,omitempty"`
 	Quantity         *int32                       `json:"quantity,omitempty"`
 	RollingUpdate    *RKEMachinePoolRollingUpdate `json:"rollingUpdate,omitempty"`
+	HealthCheck      *RKEMachinePoolHealthCheck   `json:"healthCheck,omitempty"`
+	// Let the cluster autoscaler choose the number of machines, quantity is then only used when the pool is created
+	Autoscaling *RKEMachinePoolAutoscaling `json:"autoscaling,omitempty"`
+	// Which machines are removed first when the quantity is lowered: Random, Newest or Oldest, defaults to Random.
+	// The init node of the cluster is removed last.
+	DeletePolicy string `json:"deletePolicy,omitempty"`
+	// Names of machines of the pool that are removed before any other machine when the quantity is lowered
+	MachinesToDelete []string `json:"machinesToDelete,omitempty"`
+}
+
+type RKEMachinePoolAutoscaling struct {
+	// Fewest machines the autoscaler scales the pool down to, scaling from zero requires the capacity of
+	// the machines to be known
+	MinSize int32 `json:"minSize,omitempty"`
+	// Most machines the autoscaler scales the pool up to
+	MaxSize int32 `json:"maxSize,omitempty"`
+	// Resources of a machine of the pool used by the autoscaler while the pool has no machines, keyed by
+	// cpu, memory, ephemeral-disk, gpu-count or maxPods. Defaults to the values derived from the cpuCount,
+	// memorySize and diskSize fields of the node config, sizes are in megabytes.
+	Capacity map[string]string `json:"capacity,omitempty"`
+}
+
+// RKEMachinePoolHealthCheck configures a MachineHealthCheck that replaces the unhealthy machines of the pool.
+type RKEMachinePoolHealthCheck struct {
+	// Node conditions that mark a machine as unhealthy, any of them is sufficient. Defaults to the Ready
+	// condition being False or Unknown for 5m.
+	UnhealthyConditions []RKEMachinePoolUnhealthyCondition `json:"unhealthyConditions,omitempty"`
+	// How long a machine may take to register its node before it is replaced, such as "15m", defaults to 10m
+	NodeStartupTimeout string `json:"nodeStartupTimeout,omitempty"`
+	// Machines are only replaced while at most this number or percentage (ex: 40%) of the machines of the
+	// pool are unhealthy, defaults to 100%
+	MaxUnhealthy *intstr.IntOrString `json:"maxUnhealthy,omitempty"`
+}
+
+type RKEMachinePoolUnhealthyCondition struct {
+	// Type of the node condition, such as Ready
+	Type corev1.NodeConditionType `json:"type,omitempty"`
+	// Status of the condition that is considered unhealthy, True, False or Unknown
+	Status corev1.ConditionStatus `json:"status,omitempty"`
+	// How long the condition must have the status, such as "5m"
+	Timeout string `json:"timeout,omitempty"`
 }
 
 type RKEMachinePoolRollingUpdate struct {
@@ -303,6 +303,55 @@ func (in *RKEConfig) DeepCopy() *RKEConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RKEMachinePoolAutoscaling) DeepCopyInto(out *RKEMachinePoolAutoscaling) {
+	*out = *in
+	if in.Capacity != nil {
+		in, out := &in.Capacity, &out.Capacity
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RKEMachinePoolAutoscaling.
+func (in *RKEMachinePoolAutoscaling) DeepCopy() *RKEMachinePoolAutoscaling {
+	if in == nil {
+		return nil
+	}
+	out := new(RKEMachinePoolAutoscaling)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RKEMachinePoolHealthCheck) DeepCopyInto(out *RKEMachinePoolHealthCheck) {
+	*out = *in
+	if in.UnhealthyConditions != nil {
+		in, out := &in.UnhealthyConditions, &out.UnhealthyConditions
+		*out = make([]RKEMachinePoolUnhealthyCondition, len(*in))
+		copy(*out, *in)
+	}
+	if in.MaxUnhealthy != nil {
+		in, out := &in.MaxUnhealthy, &out.MaxUnhealthy
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RKEMachinePoolHealthCheck.
+func (in *RKEMachinePoolHealthCheck) DeepCopy() *RKEMachinePoolHealthCheck {
+	if in == nil {
+		return nil
+	}
+	out := new(RKEMachinePoolHealthCheck)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RKEMachinePoolRollingUpdate) DeepCopyInto(out *RKEMachinePoolRollingUpdate) {
 	*out = *in
@@ -329,6 +378,22 @@ func (in *RKEMachinePoolRollingUpdate) DeepCopy() *RKEMachinePoolRollingUpdate {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RKEMachinePoolUnhealthyCondition) DeepCopyInto(out *RKEMachinePoolUnhealthyCondition) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RKEMachinePoolUnhealthyCondition.
+func (in *RKEMachinePoolUnhealthyCondition) DeepCopy() *RKEMachinePoolUnhealthyCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(RKEMachinePoolUnhealthyCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RKENodePool) DeepCopyInto(out *RKENodePool) {
 	*out = *in
@@ -363,6 +428,21 @@ func (in *RKENodePool) DeepCopyInto(out *RKENodePool) {
 		*out = new(RKEMachinePoolRollingUpdate)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.HealthCheck != nil {
+		in, out := &in.HealthCheck, &out.HealthCheck
+		*out = new(RKEMachinePoolHealthCheck)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Autoscaling != nil {
+		in, out := &in.Autoscaling, &out.Autoscaling
+		*out = new(RKEMachinePoolAutoscaling)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MachinesToDelete != nil {
+		in, out := &in.MachinesToDelete, &out.MachinesToDelete
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -0,0 +1,13 @@
+package v1
+
+type AddonManifest struct {
+	// Name of the add-on, the manifest is written to <name>.yaml in the manifests directory of the runtime. Names of
+	// the manifests deployed by the runtime, such as coredns or rke2-canal, and of chart values can't be used
+	Name string `json:"name,omitempty"`
+	// Inline YAML manifest
+	Content string `json:"content,omitempty"`
+	// ConfigMap in the same namespace holding the manifest, used if content is empty
+	ConfigMapName string `json:"configMapName,omitempty"`
+	// Key of the ConfigMap holding the manifest, if empty all keys are used in order
+	ConfigMapKey string `json:"configMapKey,omitempty"`
+}
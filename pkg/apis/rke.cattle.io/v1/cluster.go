@@ -3,6 +3,7 @@ package v1
 import (
 	"github.com/rancher/wrangler/pkg/genericcondition"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // +genclient
@@ -24,12 +25,42 @@ type RKEClusterStatus struct {
 type RKEClusterSpecCommon struct {
 	UpgradeStrategy ClusterUpgradeStrategy `json:"upgradeStrategy,omitempty"`
 	Config          []RKESystemConfig      `json:"config,omitempty"`
+
+	ETCD                *ETCD                `json:"etcd,omitempty"`
+	ETCDSnapshotCreate  *ETCDSnapshotCreate  `json:"etcdSnapshotCreate,omitempty"`
+	ETCDSnapshotRestore *ETCDSnapshotRestore `json:"etcdSnapshotRestore,omitempty"`
+	// External SQL datastore used by k3s servers in place of embedded etcd, clusters using it have no etcd machines
+	Datastore *Datastore `json:"datastore,omitempty"`
+
+	Registries *Registry `json:"registries,omitempty"`
+
+	RotateTokens *RotateTokens `json:"rotateTokens,omitempty"`
+
+	// Manifests deployed by the runtime on control plane machines
+	AdditionalManifests []AddonManifest `json:"additionalManifests,omitempty"`
+	// Values for the charts bundled with the runtime keyed by chart name, such as rke2-canal or traefik,
+	// delivered as HelmChartConfig
+	ChartValues GenericMap `json:"chartValues,omitempty"`
+}
+
+type RotateTokens struct {
+	// Changing the generation will generate new server and agent tokens and roll them out to all machines,
+	// requires rke2 or k3s v1.28 or newer
+	Generation int `json:"generation,omitempty"`
 }
 
+// RKESystemConfig entries are merged per machine. Entries without a machine name or selector apply to all
+// machines and are merged first, followed by entries with a matching selector and last entries naming the machine.
+// Keys of later entries override keys of earlier entries.
 type RKESystemConfig struct {
-	MachineName          string                `json:"machineName,omitempty"`
+	// Name of the CAPI machine this config applies to
+	MachineName string `json:"machineName,omitempty"`
+	// Selector matched against the labels of the CAPI machine and the labels of its node
 	MachineLabelSelector *metav1.LabelSelector `json:"machineLabelSelector,omitempty"`
-	Config               GenericMap            `json:"config,omitempty"`
+	// Typed settings validated against the runtime, the free-form config of the same entry is applied on top
+	RuntimeConfig *RuntimeConfig `json:"runtimeConfig,omitempty"`
+	// Free-form keys of the rke2 or k3s config file, values can be read from secrets, see ConfigValueFrom
+	Config GenericMap `json:"config,omitempty"`
 }
 
 type RKEClusterSpec struct {
@@ -38,14 +69,46 @@ type RKEClusterSpec struct {
 }
 
 type ClusterUpgradeStrategy struct {
-	// How many controlplane nodes should be upgrade at time, defaults to 1
-	ServerConcurrency int `json:"serverConcurrency,omitempty" norman:"min=1"`
+	// How many controlplane nodes should be upgrade at time, all of them if unset
+	// Value can be an absolute number (ex: 5) or a percentage of the etcd or control
+	// plane machines being upgraded (ex: 10%). Percentages are rounded down but are at least 1.
+	ServerConcurrency *intstr.IntOrString `json:"serverConcurrency,omitempty"`
 	// How many workers should be upgraded at a time
-	WorkerConcurrency int `json:"workerConcurrency,omitempty" norman:"min=1"`
+	// Value can be an absolute number (ex: 5) or a percentage of the worker
+	// machines (ex: 10%). Percentages are rounded down but are at least 1.
+	WorkerConcurrency *intstr.IntOrString `json:"workerConcurrency,omitempty"`
 	// Whether controlplane nodes should be drained
 	DrainServerNodes bool `json:"drainServerNodes,omitempty"`
 	// Whether worker nodes should be drained
 	DrainWorkerNodes bool `json:"drainWorkerNodes,omitempty"`
+	// Options used when draining nodes
+	DrainOptions DrainOptions `json:"drainOptions,omitempty"`
+	// Stop changing the plans of provisioned machines, new machines are still provisioned
+	Paused bool `json:"paused,omitempty"`
+	// Windows in which the plans of provisioned machines may be changed, if empty they can always be changed
+	MaintenanceWindows []MaintenanceWindow `json:"maintenanceWindows,omitempty"`
+	// IANA time zone the maintenance window schedules are evaluated in, defaults to UTC
+	MaintenanceWindowTimeZone string `json:"maintenanceWindowTimeZone,omitempty"`
+}
+
+type MaintenanceWindow struct {
+	// Cron expression, such as "0 2 * * 6", for when the window opens
+	Schedule string `json:"schedule,omitempty"`
+	// How long the window stays open, such as "4h"
+	Duration string `json:"duration,omitempty"`
+}
+
+type DrainOptions struct {
+	// Seconds to wait for a node to drain before failing, zero waits forever
+	Timeout int `json:"timeout,omitempty"`
+	// Seconds given to each pod to terminate gracefully, zero uses the grace period of the pod
+	GracePeriod int `json:"gracePeriod,omitempty"`
+	// Whether pods using emptyDir volumes should be evicted, their local data will be lost
+	DeleteEmptyDirData bool `json:"deleteEmptyDirData,omitempty"`
+	// Whether DaemonSet managed pods should be left running on the node, defaults to true
+	IgnoreDaemonSets *bool `json:"ignoreDaemonSets,omitempty"`
+	// Whether pods not managed by a controller should be evicted
+	Force bool `json:"force,omitempty"`
 }
 
 type Endpoint struct {
@@ -20,6 +20,9 @@ type RKEControlPlaneSpec struct {
 
 	KubernetesVersion     string `json:"kubernetesVersion,omitempty"`
 	ManagementClusterName string `json:"managementClusterName,omitempty" wrangler:"required"`
+	// Image used to install the runtime on the machines, used as is instead of resolving the image
+	// from the system-agent-installer-image setting and the kubernetes version
+	SystemAgentInstallerImage string `json:"systemAgentInstallerImage,omitempty"`
 }
 
 type RKEControlPlaneStatus struct {
@@ -27,4 +30,15 @@ type RKEControlPlaneStatus struct {
 	Ready                  bool                                `json:"ready,omitempty"`
 	ObservedGeneration     int64                               `json:"observedGeneration"`
 	ClusterStateSecretName string                              `json:"clusterStateSecretName,omitempty"`
+
+	ETCDSnapshotCreateGeneration  int            `json:"etcdSnapshotCreateGeneration,omitempty"`
+	ETCDSnapshotRestoreGeneration int            `json:"etcdSnapshotRestoreGeneration,omitempty"`
+	ETCDSnapshotRestorePhase      string         `json:"etcdSnapshotRestorePhase,omitempty"`
+	ETCDSnapshots                 []ETCDSnapshot `json:"etcdSnapshots,omitempty"`
+
+	TokenRotationGeneration int    `json:"tokenRotationGeneration,omitempty"`
+	TokenRotationPhase      string `json:"tokenRotationPhase,omitempty"`
+
+	// When the next maintenance window opens, set while the maintenance windows are closed
+	NextMaintenanceWindow *metav1.Time `json:"nextMaintenanceWindow,omitempty"`
 }
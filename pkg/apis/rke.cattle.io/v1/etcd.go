@@ -0,0 +1,48 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type ETCD struct {
+	// Disable the scheduled snapshots taken by the etcd nodes
+	DisableSnapshots bool `json:"disableSnapshots,omitempty"`
+	// Cron expression for scheduled snapshots, defaults to the runtime default of every 12 hours
+	SnapshotScheduleCron string `json:"snapshotScheduleCron,omitempty"`
+	// Number of snapshots to keep per node, defaults to the runtime default of 5
+	SnapshotRetention int `json:"snapshotRetention,omitempty"`
+	// Upload snapshots to an S3 compatible object store
+	S3 *ETCDSnapshotS3 `json:"s3,omitempty"`
+}
+
+type ETCDSnapshotS3 struct {
+	Endpoint      string `json:"endpoint,omitempty"`
+	EndpointCA    string `json:"endpointCA,omitempty"`
+	SkipSSLVerify bool   `json:"skipSSLVerify,omitempty"`
+	Bucket        string `json:"bucket,omitempty"`
+	Region        string `json:"region,omitempty"`
+	Folder        string `json:"folder,omitempty"`
+	// Name of a secret in the same namespace with the keys accessKey and secretKey
+	CredentialSecretName string `json:"credentialSecretName,omitempty"`
+}
+
+type ETCDSnapshotCreate struct {
+	// Changing the generation will cause a new snapshot to be taken on the init node
+	Generation int `json:"generation,omitempty"`
+}
+
+type ETCDSnapshotRestore struct {
+	// Name of the snapshot to restore, as listed in the etcdSnapshots status of the control plane
+	Name string `json:"name,omitempty"`
+	// Changing the generation will cause the named snapshot to be restored
+	Generation int `json:"generation,omitempty"`
+}
+
+type ETCDSnapshot struct {
+	Name      string       `json:"name,omitempty"`
+	NodeName  string       `json:"nodeName,omitempty"`
+	Location  string       `json:"location,omitempty"`
+	Size      int64        `json:"size,omitempty"`
+	CreatedAt *metav1.Time `json:"createdAt,omitempty"`
+	S3        bool         `json:"s3,omitempty"`
+}
@@ -1,6 +1,7 @@
 package plan
 
 import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
 )
 
@@ -14,6 +15,28 @@ type Node struct {
 	Plan        NodePlan  `json:"plan,omitempty"`
 	AppliedPlan *NodePlan `json:"appliedPlan,omitempty"`
 	InSync      bool      `json:"inSync,omitempty"`
+	// Results of the instructions of the last plan run by the agent
+	Results []InstructionResult `json:"results,omitempty"`
+	// Failed is true if an instruction of the current plan exited with a non-zero exit code
+	Failed bool `json:"failed,omitempty"`
+	// OneShot is true while a one-shot plan is assigned in place of the plan, see PlanStore.RunOneShot
+	OneShot bool `json:"oneShot,omitempty"`
+	// Status of the probes of the plan as reported by the agent
+	ProbeStatus map[string]ProbeStatus `json:"probeStatus,omitempty"`
+	// Healthy is true if the plan is applied and all of its probes are passing, or the agent does not report probes
+	Healthy bool `json:"healthy,omitempty"`
+	// Previously applied plans, most recent first
+	History []PlanRecord `json:"history,omitempty"`
+}
+
+type PlanRecord struct {
+	Plan NodePlan `json:"plan,omitempty"`
+	// Time the plan was replaced by a newer plan
+	ReplacedAt metav1.Time `json:"replacedAt,omitempty"`
+	// Healthy is true if the plan was applied and all of its probes were passing when it was replaced
+	Healthy bool `json:"healthy,omitempty"`
+	// Summary of the changes made by the plan that replaced this one
+	Summary string `json:"summary,omitempty"`
 }
 
 type Secret struct {
@@ -29,14 +52,64 @@ type Instruction struct {
 	Command string   `json:"command,omitempty"`
 }
 
+// InstructionResult is reported by the agent for each instruction it ran. Stdout and Stderr are truncated
+// by the agent to the last few kilobytes of output.
+type InstructionResult struct {
+	Name       string       `json:"name,omitempty"`
+	ExitCode   int          `json:"exitCode"`
+	Stdout     string       `json:"stdout,omitempty"`
+	Stderr     string       `json:"stderr,omitempty"`
+	StartTime  *metav1.Time `json:"startTime,omitempty"`
+	FinishTime *metav1.Time `json:"finishTime,omitempty"`
+}
+
 type File struct {
 	Content string `json:"content,omitempty"`
 	Name    string `json:"name,omitempty"`
 	Path    string `json:"path,omitempty"`
+	// Octal file mode such as 0600, the agent default is used if empty
+	Permissions string `json:"permissions,omitempty"`
+	// User and group owning the file, given as a name or numeric id
+	Owner string `json:"owner,omitempty"`
+	Group string `json:"group,omitempty"`
+	// Delete marks the file to be removed from the node, Content is ignored
+	Delete bool `json:"delete,omitempty"`
+}
+
+type Probe struct {
+	// Seconds to wait after the plan is applied before probing
+	InitialDelaySeconds int `json:"initialDelaySeconds,omitempty"`
+	// Seconds between probes
+	PeriodSeconds int `json:"periodSeconds,omitempty"`
+	// Seconds after which a probe times out
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+	// Consecutive successes needed to become healthy
+	SuccessThreshold int `json:"successThreshold,omitempty"`
+	// Consecutive failures needed to become unhealthy
+	FailureThreshold int           `json:"failureThreshold,omitempty"`
+	HTTPGetAction    HTTPGetAction `json:"httpGet,omitempty"`
+}
+
+type HTTPGetAction struct {
+	URL      string `json:"url,omitempty"`
+	Insecure bool   `json:"insecure,omitempty"`
+	// Paths on the node of the CA and client certificate used to connect to URL
+	CACert     string `json:"caCert,omitempty"`
+	ClientCert string `json:"clientCert,omitempty"`
+	ClientKey  string `json:"clientKey,omitempty"`
+	// The status code the probe expects, any 2xx status code if zero
+	ExpectedStatus int `json:"expectedStatus,omitempty"`
+}
+
+type ProbeStatus struct {
+	Healthy      bool `json:"healthy,omitempty"`
+	SuccessCount int  `json:"successCount,omitempty"`
+	FailureCount int  `json:"failureCount,omitempty"`
 }
 
 type NodePlan struct {
-	Files        []File        `json:"files,omitempty"`
-	Instructions []Instruction `json:"instructions,omitempty"`
-	Error        string        `json:"error,omitempty"`
+	Files        []File           `json:"files,omitempty"`
+	Instructions []Instruction    `json:"instructions,omitempty"`
+	Probes       map[string]Probe `json:"probes,omitempty"`
+	Error        string           `json:"error,omitempty"`
 }
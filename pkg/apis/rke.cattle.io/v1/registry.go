@@ -0,0 +1,23 @@
+package v1
+
+type Registry struct {
+	// Mirrors keyed by the registry host name, "*" applies to all registries
+	Mirrors map[string]Mirror `json:"mirrors,omitempty"`
+	// Configs keyed by the registry host name
+	Configs map[string]RegistryConfig `json:"configs,omitempty"`
+}
+
+type Mirror struct {
+	// Endpoints tried in order before falling back to the registry itself
+	Endpoints []string `json:"endpoints,omitempty"`
+	// Regular expressions rewriting image names before pulling from the mirror
+	Rewrites map[string]string `json:"rewrites,omitempty"`
+}
+
+type RegistryConfig struct {
+	// Name of a secret in the same namespace with the keys username and password
+	AuthConfigSecretName string `json:"authConfigSecretName,omitempty"`
+	// Name of a secret in the same namespace with the optional keys ca.crt, tls.crt and tls.key
+	TLSSecretName      string `json:"tlsSecretName,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+}
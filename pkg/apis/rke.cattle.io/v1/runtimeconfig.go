@@ -0,0 +1,54 @@
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// RuntimeConfig holds the commonly used settings of the rke2 and k3s config file. Settings that are not listed here
+// can still be set through the free-form config of the RKESystemConfig.
+type RuntimeConfig struct {
+	// IPv4/IPv6 network CIDRs to use for pod IPs, comma separated for dual-stack
+	ClusterCIDR string `json:"clusterCIDR,omitempty"`
+	// IPv4/IPv6 network CIDRs to use for service IPs, comma separated for dual-stack
+	ServiceCIDR string `json:"serviceCIDR,omitempty"`
+	// IPv4 cluster IP for the coredns service, must be within the service CIDR
+	ClusterDNS string `json:"clusterDNS,omitempty"`
+	// Cluster domain, defaults to cluster.local
+	ClusterDomain string `json:"clusterDomain,omitempty"`
+	// CNI plugin to deploy, rke2 only: canal, calico, cilium or none
+	CNI string `json:"cni,omitempty"`
+	// Flannel backend, k3s only: none, vxlan, ipsec, host-gw or wireguard
+	FlannelBackend string `json:"flannelBackend,omitempty"`
+	// Packaged components to not deploy, such as rke2-ingress-nginx for rke2 or traefik for k3s
+	Disable []string `json:"disable,omitempty"`
+	// Disable running kube-proxy
+	DisableKubeProxy bool `json:"disableKubeProxy,omitempty"`
+	// Additional hostnames or IPs added as subject alternative names to the serving certificate
+	TLSSAN []string `json:"tlsSAN,omitempty"`
+	// Additional arguments in the form key=value
+	KubeAPIServerArg         []string `json:"kubeAPIServerArg,omitempty"`
+	KubeControllerManagerArg []string `json:"kubeControllerManagerArg,omitempty"`
+	KubeSchedulerArg         []string `json:"kubeSchedulerArg,omitempty"`
+	KubeletArg               []string `json:"kubeletArg,omitempty"`
+	KubeProxyArg             []string `json:"kubeProxyArg,omitempty"`
+	ETCDArg                  []string `json:"etcdArg,omitempty"`
+	// Expose etcd metrics to the client interface
+	ETCDExposeMetrics bool `json:"etcdExposeMetrics,omitempty"`
+	// CIS profile to validate the node against, rke2 only
+	Profile string `json:"profile,omitempty"`
+	// Enable SELinux in containerd
+	SELinux bool `json:"selinux,omitempty"`
+	// Exit if the kernel tunables differ from the kubelet defaults
+	ProtectKernelDefaults bool `json:"protectKernelDefaults,omitempty"`
+}
+
+// ConfigValueFrom is used in place of a value of the free-form config to read the value from a secret in the same
+// namespace, for example {"datastore-endpoint": {"valueFrom": {"secretKeyRef": {"name": "db", "key": "endpoint"}}}}
+type ConfigValueFrom struct {
+	ValueFrom ConfigValueSource `json:"valueFrom"`
+}
+
+type ConfigValueSource struct {
+	// Key of a secret in the same namespace, keys of optional references to missing secrets are left out
+	SecretKeyRef *corev1.SecretKeySelector `json:"secretKeyRef,omitempty"`
+}
@@ -25,11 +25,44 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
+	intstr "k8s.io/apimachinery/pkg/util/intstr"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AddonManifest) DeepCopyInto(out *AddonManifest) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AddonManifest.
+func (in *AddonManifest) DeepCopy() *AddonManifest {
+	if in == nil {
+		return nil
+	}
+	out := new(AddonManifest)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterUpgradeStrategy) DeepCopyInto(out *ClusterUpgradeStrategy) {
 	*out = *in
+	if in.ServerConcurrency != nil {
+		in, out := &in.ServerConcurrency, &out.ServerConcurrency
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.WorkerConcurrency != nil {
+		in, out := &in.WorkerConcurrency, &out.WorkerConcurrency
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	in.DrainOptions.DeepCopyInto(&out.DrainOptions)
+	if in.MaintenanceWindows != nil {
+		in, out := &in.MaintenanceWindows, &out.MaintenanceWindows
+		*out = make([]MaintenanceWindow, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -43,6 +76,170 @@ func (in *ClusterUpgradeStrategy) DeepCopy() *ClusterUpgradeStrategy {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConfigValueFrom) DeepCopyInto(out *ConfigValueFrom) {
+	*out = *in
+	in.ValueFrom.DeepCopyInto(&out.ValueFrom)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigValueFrom.
+func (in *ConfigValueFrom) DeepCopy() *ConfigValueFrom {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigValueFrom)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConfigValueSource) DeepCopyInto(out *ConfigValueSource) {
+	*out = *in
+	if in.SecretKeyRef != nil {
+		in, out := &in.SecretKeyRef, &out.SecretKeyRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigValueSource.
+func (in *ConfigValueSource) DeepCopy() *ConfigValueSource {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigValueSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Datastore) DeepCopyInto(out *Datastore) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Datastore.
+func (in *Datastore) DeepCopy() *Datastore {
+	if in == nil {
+		return nil
+	}
+	out := new(Datastore)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DrainOptions) DeepCopyInto(out *DrainOptions) {
+	*out = *in
+	if in.IgnoreDaemonSets != nil {
+		in, out := &in.IgnoreDaemonSets, &out.IgnoreDaemonSets
+		*out = new(bool)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DrainOptions.
+func (in *DrainOptions) DeepCopy() *DrainOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(DrainOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ETCD) DeepCopyInto(out *ETCD) {
+	*out = *in
+	if in.S3 != nil {
+		in, out := &in.S3, &out.S3
+		*out = new(ETCDSnapshotS3)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ETCD.
+func (in *ETCD) DeepCopy() *ETCD {
+	if in == nil {
+		return nil
+	}
+	out := new(ETCD)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ETCDSnapshot) DeepCopyInto(out *ETCDSnapshot) {
+	*out = *in
+	if in.CreatedAt != nil {
+		in, out := &in.CreatedAt, &out.CreatedAt
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ETCDSnapshot.
+func (in *ETCDSnapshot) DeepCopy() *ETCDSnapshot {
+	if in == nil {
+		return nil
+	}
+	out := new(ETCDSnapshot)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ETCDSnapshotCreate) DeepCopyInto(out *ETCDSnapshotCreate) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ETCDSnapshotCreate.
+func (in *ETCDSnapshotCreate) DeepCopy() *ETCDSnapshotCreate {
+	if in == nil {
+		return nil
+	}
+	out := new(ETCDSnapshotCreate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ETCDSnapshotRestore) DeepCopyInto(out *ETCDSnapshotRestore) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ETCDSnapshotRestore.
+func (in *ETCDSnapshotRestore) DeepCopy() *ETCDSnapshotRestore {
+	if in == nil {
+		return nil
+	}
+	out := new(ETCDSnapshotRestore)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ETCDSnapshotS3) DeepCopyInto(out *ETCDSnapshotS3) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ETCDSnapshotS3.
+func (in *ETCDSnapshotS3) DeepCopy() *ETCDSnapshotS3 {
+	if in == nil {
+		return nil
+	}
+	out := new(ETCDSnapshotS3)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Endpoint) DeepCopyInto(out *Endpoint) {
 	*out = *in
@@ -69,6 +266,50 @@ func (in *GenericMap) DeepCopy() *GenericMap {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaintenanceWindow) DeepCopyInto(out *MaintenanceWindow) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaintenanceWindow.
+func (in *MaintenanceWindow) DeepCopy() *MaintenanceWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(MaintenanceWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Mirror) DeepCopyInto(out *Mirror) {
+	*out = *in
+	if in.Endpoints != nil {
+		in, out := &in.Endpoints, &out.Endpoints
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Rewrites != nil {
+		in, out := &in.Rewrites, &out.Rewrites
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Mirror.
+func (in *Mirror) DeepCopy() *Mirror {
+	if in == nil {
+		return nil
+	}
+	out := new(Mirror)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RKEBootstrap) DeepCopyInto(out *RKEBootstrap) {
 	*out = *in
@@ -329,7 +570,7 @@ func (in *RKEClusterSpec) DeepCopy() *RKEClusterSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RKEClusterSpecCommon) DeepCopyInto(out *RKEClusterSpecCommon) {
 	*out = *in
-	out.UpgradeStrategy = in.UpgradeStrategy
+	in.UpgradeStrategy.DeepCopyInto(&out.UpgradeStrategy)
 	if in.Config != nil {
 		in, out := &in.Config, &out.Config
 		*out = make([]RKESystemConfig, len(*in))
@@ -337,6 +578,42 @@ func (in *RKEClusterSpecCommon) DeepCopyInto(out *RKEClusterSpecCommon) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.ETCD != nil {
+		in, out := &in.ETCD, &out.ETCD
+		*out = new(ETCD)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ETCDSnapshotCreate != nil {
+		in, out := &in.ETCDSnapshotCreate, &out.ETCDSnapshotCreate
+		*out = new(ETCDSnapshotCreate)
+		**out = **in
+	}
+	if in.ETCDSnapshotRestore != nil {
+		in, out := &in.ETCDSnapshotRestore, &out.ETCDSnapshotRestore
+		*out = new(ETCDSnapshotRestore)
+		**out = **in
+	}
+	if in.Datastore != nil {
+		in, out := &in.Datastore, &out.Datastore
+		*out = new(Datastore)
+		**out = **in
+	}
+	if in.Registries != nil {
+		in, out := &in.Registries, &out.Registries
+		*out = new(Registry)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RotateTokens != nil {
+		in, out := &in.RotateTokens, &out.RotateTokens
+		*out = new(RotateTokens)
+		**out = **in
+	}
+	if in.AdditionalManifests != nil {
+		in, out := &in.AdditionalManifests, &out.AdditionalManifests
+		*out = make([]AddonManifest, len(*in))
+		copy(*out, *in)
+	}
+	in.ChartValues.DeepCopyInto(&out.ChartValues)
 	return
 }
 
@@ -487,6 +764,17 @@ func (in *RKEControlPlaneStatus) DeepCopyInto(out *RKEControlPlaneStatus) {
 		*out = make([]genericcondition.GenericCondition, len(*in))
 		copy(*out, *in)
 	}
+	if in.ETCDSnapshots != nil {
+		in, out := &in.ETCDSnapshots, &out.ETCDSnapshots
+		*out = make([]ETCDSnapshot, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.NextMaintenanceWindow != nil {
+		in, out := &in.NextMaintenanceWindow, &out.NextMaintenanceWindow
+		*out = (*in).DeepCopy()
+	}
 	return
 }
 
@@ -524,6 +812,11 @@ func (in *RKESystemConfig) DeepCopyInto(out *RKESystemConfig) {
 		*out = new(metav1.LabelSelector)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.RuntimeConfig != nil {
+		in, out := &in.RuntimeConfig, &out.RuntimeConfig
+		*out = new(RuntimeConfig)
+		(*in).DeepCopyInto(*out)
+	}
 	in.Config.DeepCopyInto(&out.Config)
 	return
 }
@@ -538,6 +831,124 @@ func (in *RKESystemConfig) DeepCopy() *RKESystemConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Registry) DeepCopyInto(out *Registry) {
+	*out = *in
+	if in.Mirrors != nil {
+		in, out := &in.Mirrors, &out.Mirrors
+		*out = make(map[string]Mirror, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
+	if in.Configs != nil {
+		in, out := &in.Configs, &out.Configs
+		*out = make(map[string]RegistryConfig, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Registry.
+func (in *Registry) DeepCopy() *Registry {
+	if in == nil {
+		return nil
+	}
+	out := new(Registry)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RegistryConfig) DeepCopyInto(out *RegistryConfig) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RegistryConfig.
+func (in *RegistryConfig) DeepCopy() *RegistryConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(RegistryConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RotateTokens) DeepCopyInto(out *RotateTokens) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RotateTokens.
+func (in *RotateTokens) DeepCopy() *RotateTokens {
+	if in == nil {
+		return nil
+	}
+	out := new(RotateTokens)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RuntimeConfig) DeepCopyInto(out *RuntimeConfig) {
+	*out = *in
+	if in.Disable != nil {
+		in, out := &in.Disable, &out.Disable
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.TLSSAN != nil {
+		in, out := &in.TLSSAN, &out.TLSSAN
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.KubeAPIServerArg != nil {
+		in, out := &in.KubeAPIServerArg, &out.KubeAPIServerArg
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.KubeControllerManagerArg != nil {
+		in, out := &in.KubeControllerManagerArg, &out.KubeControllerManagerArg
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.KubeSchedulerArg != nil {
+		in, out := &in.KubeSchedulerArg, &out.KubeSchedulerArg
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.KubeletArg != nil {
+		in, out := &in.KubeletArg, &out.KubeletArg
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.KubeProxyArg != nil {
+		in, out := &in.KubeProxyArg, &out.KubeProxyArg
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ETCDArg != nil {
+		in, out := &in.ETCDArg, &out.ETCDArg
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RuntimeConfig.
+func (in *RuntimeConfig) DeepCopy() *RuntimeConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(RuntimeConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *UnmanagedMachine) DeepCopyInto(out *UnmanagedMachine) {
 	*out = *in
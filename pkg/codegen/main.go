@@ -41,6 +41,8 @@ func main() {
 				Types: []interface{}{
 					capi.Machine{},
 					capi.MachineDeployment{},
+					capi.MachineHealthCheck{},
+					capi.MachineSet{},
 					capi.Cluster{},
 				},
 			},
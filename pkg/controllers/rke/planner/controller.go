@@ -3,6 +3,7 @@ package planner
 import (
 	"context"
 	"errors"
+	"time"
 
 	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
 	"github.com/rancher/rancher-operator/pkg/clients"
@@ -19,16 +20,26 @@ import (
 
 const (
 	Provisioned = condition.Cond("Provisioned")
+
+	bySecretReference    = "by-secret-reference"
+	byConfigMapReference = "by-config-map-reference"
+
+	// how often the etcd snapshot list is refreshed from the downstream cluster
+	etcdSnapshotRefreshInterval = 5 * time.Minute
 )
 
 type handler struct {
-	planner *planner.Planner
+	planner       *planner.Planner
+	controlPlanes v1.RKEControlPlaneController
 }
 
 func Register(ctx context.Context, clients *clients.Clients) {
 	h := handler{
-		planner: planner.New(ctx, clients),
+		planner:       planner.New(ctx, clients),
+		controlPlanes: clients.RKE.RKEControlPlane(),
 	}
+	clients.RKE.RKEControlPlane().Cache().AddIndexer(bySecretReference, bySecretReferenceIndex)
+	clients.RKE.RKEControlPlane().Cache().AddIndexer(byConfigMapReference, byConfigMapReferenceIndex)
 	v1.RegisterRKEControlPlaneStatusHandler(ctx,
 		clients.RKE.RKEControlPlane(), "", "planner", h.OnChange)
 	relatedresource.Watch(ctx, "planner", func(namespace, name string, obj runtime.Object) ([]relatedresource.Key, error) {
@@ -40,6 +51,31 @@ func Register(ctx context.Context, clients *clients.Clients) {
 					Name:      clusterName,
 				}}, nil
 			}
+			controlPlanes, err := clients.RKE.RKEControlPlane().Cache().GetByIndex(bySecretReference, secret.Namespace+"/"+secret.Name)
+			if err != nil {
+				return nil, err
+			}
+			var result []relatedresource.Key
+			for _, controlPlane := range controlPlanes {
+				result = append(result, relatedresource.Key{
+					Namespace: controlPlane.Namespace,
+					Name:      controlPlane.Name,
+				})
+			}
+			return result, nil
+		} else if configMap, ok := obj.(*corev1.ConfigMap); ok {
+			controlPlanes, err := clients.RKE.RKEControlPlane().Cache().GetByIndex(byConfigMapReference, configMap.Namespace+"/"+configMap.Name)
+			if err != nil {
+				return nil, err
+			}
+			var result []relatedresource.Key
+			for _, controlPlane := range controlPlanes {
+				result = append(result, relatedresource.Key{
+					Namespace: controlPlane.Namespace,
+					Name:      controlPlane.Name,
+				})
+			}
+			return result, nil
 		} else if machine, ok := obj.(*capi.Machine); ok {
 			return []relatedresource.Key{{
 				Namespace: machine.Namespace,
@@ -47,13 +83,50 @@ func Register(ctx context.Context, clients *clients.Clients) {
 			}}, nil
 		}
 		return nil, nil
-	}, clients.RKE.RKEControlPlane(), clients.Core.Secret(), clients.CAPI.Machine())
+	}, clients.RKE.RKEControlPlane(), clients.Core.Secret(), clients.Core.ConfigMap(), clients.CAPI.Machine())
+}
+
+// bySecretReferenceIndex indexes control planes by the secrets referenced from their spec so that
+// changes to those secrets cause the plans to be reevaluated
+func bySecretReferenceIndex(obj *rkev1.RKEControlPlane) ([]string, error) {
+	var result []string
+	if obj.Spec.ETCD != nil && obj.Spec.ETCD.S3 != nil && obj.Spec.ETCD.S3.CredentialSecretName != "" {
+		result = append(result, obj.Namespace+"/"+obj.Spec.ETCD.S3.CredentialSecretName)
+	}
+	if obj.Spec.Datastore != nil && obj.Spec.Datastore.SecretName != "" {
+		result = append(result, obj.Namespace+"/"+obj.Spec.Datastore.SecretName)
+	}
+	if obj.Spec.Registries != nil {
+		for _, config := range obj.Spec.Registries.Configs {
+			if config.AuthConfigSecretName != "" {
+				result = append(result, obj.Namespace+"/"+config.AuthConfigSecretName)
+			}
+			if config.TLSSecretName != "" {
+				result = append(result, obj.Namespace+"/"+config.TLSSecretName)
+			}
+		}
+	}
+	for _, name := range planner.ConfigSecretReferences(obj) {
+		result = append(result, obj.Namespace+"/"+name)
+	}
+	return result, nil
+}
+
+// byConfigMapReferenceIndex indexes control planes by the config maps holding their additional manifests
+func byConfigMapReferenceIndex(obj *rkev1.RKEControlPlane) ([]string, error) {
+	var result []string
+	for _, manifest := range obj.Spec.AdditionalManifests {
+		if manifest.ConfigMapName != "" {
+			result = append(result, obj.Namespace+"/"+manifest.ConfigMapName)
+		}
+	}
+	return result, nil
 }
 
 func (h *handler) OnChange(cluster *rkev1.RKEControlPlane, status rkev1.RKEControlPlaneStatus) (rkev1.RKEControlPlaneStatus, error) {
+	status, err := h.planner.Process(cluster)
 	status.ObservedGeneration = cluster.Generation
 
-	err := h.planner.Process(cluster)
 	var errWaiting planner.ErrWaiting
 	if errors.As(err, &errWaiting) {
 		logrus.Infof("rkecluster %s/%s: %v", cluster.Namespace, cluster.Name, err)
@@ -63,6 +136,18 @@ func (h *handler) OnChange(cluster *rkev1.RKEControlPlane, status rkev1.RKEContr
 		return status, nil
 	}
 
+	var errFailed planner.ErrFailed
+	if errors.As(err, &errFailed) {
+		// the failure is retried by the planner, the status holds the details
+		logrus.Errorf("rkecluster %s/%s: %v", cluster.Namespace, cluster.Name, err)
+		Provisioned.SetError(&status, "", err)
+		return status, nil
+	}
+
+	if err == nil {
+		h.controlPlanes.EnqueueAfter(cluster.Namespace, cluster.Name, etcdSnapshotRefreshInterval)
+	}
+
 	Provisioned.SetError(&status, "", err)
 	return status, err
 }
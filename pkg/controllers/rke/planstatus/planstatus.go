@@ -3,8 +3,6 @@ package planstatus
 import (
 	"bytes"
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 
 	"github.com/rancher/rancher-operator/pkg/clients"
 	capicontrollers "github.com/rancher/rancher-operator/pkg/generated/controllers/cluster.x-k8s.io/v1alpha4"
@@ -126,7 +124,7 @@ func (h *handler) OnChange(key string, secret *corev1.Secret) (*corev1.Secret, e
 	plan := secret.Data["plan"]
 	appliedPlan := secret.Data["appliedPlan"]
 
-	if appliedChecksum == hash(plan) {
+	if appliedChecksum == planner.PlanHash(plan) {
 		if !bytes.Equal(plan, appliedPlan) {
 			secret = secret.DeepCopy()
 			secret.Data["appliedPlan"] = plan
@@ -136,8 +134,3 @@ func (h *handler) OnChange(key string, secret *corev1.Secret) (*corev1.Secret, e
 
 	return secret, nil
 }
-
-func hash(plan []byte) string {
-	result := sha256.Sum256(plan)
-	return hex.EncodeToString(result[:])
-}
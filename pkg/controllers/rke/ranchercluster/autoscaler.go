@@ -0,0 +1,107 @@
+package ranchercluster
+
+import (
+	"fmt"
+	"strconv"
+
+	rancherv1 "github.com/rancher/rancher-operator/pkg/apis/rancher.cattle.io/v1"
+	"github.com/rancher/wrangler/pkg/data"
+	"k8s.io/apimachinery/pkg/api/resource"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+)
+
+const (
+	autoscalerMinSizeAnnotation        = "cluster.x-k8s.io/cluster-api-autoscaler-node-group-min-size"
+	autoscalerMaxSizeAnnotation        = "cluster.x-k8s.io/cluster-api-autoscaler-node-group-max-size"
+	autoscalerCapacityAnnotationPrefix = "capacity.cluster-autoscaler.kubernetes.io/"
+)
+
+var autoscalerCapacityKeys = map[string]bool{
+	"cpu":            true,
+	"memory":         true,
+	"ephemeral-disk": true,
+	"gpu-count":      true,
+	"maxPods":        true,
+}
+
+func validateAutoscaling(autoscaling *rancherv1.RKEMachinePoolAutoscaling) error {
+	if autoscaling.MinSize < 0 || autoscaling.MaxSize < 1 || autoscaling.MinSize > autoscaling.MaxSize {
+		return fmt.Errorf("autoscaling sizes must satisfy 0 <= minSize <= maxSize and maxSize >= 1, got %d and %d",
+			autoscaling.MinSize, autoscaling.MaxSize)
+	}
+	for key, value := range autoscaling.Capacity {
+		if !autoscalerCapacityKeys[key] {
+			return fmt.Errorf("invalid autoscaling capacity %s", key)
+		}
+		if _, err := resource.ParseQuantity(value); err != nil {
+			return fmt.Errorf("invalid autoscaling capacity %s %q: %w", key, value, err)
+		}
+	}
+	return nil
+}
+
+// autoscalerSizeAnnotations returns the annotations of the MachineDeployment that make it a node group of the
+// cluster autoscaler.
+func autoscalerSizeAnnotations(autoscaling *rancherv1.RKEMachinePoolAutoscaling) map[string]string {
+	return map[string]string{
+		autoscalerMinSizeAnnotation: strconv.Itoa(int(autoscaling.MinSize)),
+		autoscalerMaxSizeAnnotation: strconv.Itoa(int(autoscaling.MaxSize)),
+	}
+}
+
+// autoscalerCapacityAnnotations returns the annotations of the machine template that describe the resources of a
+// machine, the autoscaler needs them to scale a node group up from zero.
+func autoscalerCapacityAnnotations(autoscaling *rancherv1.RKEMachinePoolAutoscaling, nodeConfig data.Object) map[string]string {
+	result := map[string]string{}
+
+	if cpu := nodeConfig.String("cpuCount"); cpu != "" {
+		result[autoscalerCapacityAnnotationPrefix+"cpu"] = cpu
+	}
+	if memory := nodeConfig.String("memorySize"); memory != "" {
+		result[autoscalerCapacityAnnotationPrefix+"memory"] = memory + "Mi"
+	}
+	if disk := nodeConfig.String("diskSize"); disk != "" {
+		result[autoscalerCapacityAnnotationPrefix+"ephemeral-disk"] = disk + "Mi"
+	}
+
+	for key, value := range autoscaling.Capacity {
+		result[autoscalerCapacityAnnotationPrefix+key] = value
+	}
+
+	// derived values that are not valid quantities are left to the autoscaler to discover from running machines
+	for key, value := range result {
+		if _, err := resource.ParseQuantity(value); err != nil {
+			delete(result, key)
+		}
+	}
+
+	return result
+}
+
+// autoscaledReplicas returns the replica count of an autoscaled MachineDeployment. The count chosen by the
+// autoscaler is kept, the quantity of the pool is only used for new pools. Both are kept within the bounds of the
+// node group.
+func autoscaledReplicas(machineDeployment *capi.MachineDeployment, current *int32) (*int32, error) {
+	minSize, err := strconv.Atoi(machineDeployment.Annotations[autoscalerMinSizeAnnotation])
+	if err != nil {
+		return nil, err
+	}
+	maxSize, err := strconv.Atoi(machineDeployment.Annotations[autoscalerMaxSizeAnnotation])
+	if err != nil {
+		return nil, err
+	}
+
+	replicas := int32(1)
+	if current != nil {
+		replicas = *current
+	} else if machineDeployment.Spec.Replicas != nil {
+		replicas = *machineDeployment.Spec.Replicas
+	}
+
+	if replicas < int32(minSize) {
+		replicas = int32(minSize)
+	} else if replicas > int32(maxSize) {
+		replicas = int32(maxSize)
+	}
+	return &replicas, nil
+}
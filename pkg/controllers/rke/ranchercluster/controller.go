@@ -1,7 +1,9 @@
 package ranchercluster
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
 
@@ -12,13 +14,18 @@ import (
 	mgmtcontroller "github.com/rancher/rancher-operator/pkg/generated/controllers/management.cattle.io/v3"
 	rocontrollers "github.com/rancher/rancher-operator/pkg/generated/controllers/rancher.cattle.io/v1"
 	rkecontroller "github.com/rancher/rancher-operator/pkg/generated/controllers/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/util"
 	"github.com/rancher/wrangler/pkg/condition"
 	corecontrollers "github.com/rancher/wrangler/pkg/generated/controllers/core/v1"
+	"github.com/rancher/wrangler/pkg/relatedresource"
 	corev1 "k8s.io/api/core/v1"
 	apierror "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
 )
 
 const (
@@ -27,26 +34,34 @@ const (
 )
 
 type handler struct {
-	dynamic           *dynamic.Controller
-	dynamicSchema     mgmtcontroller.DynamicSchemaCache
-	clusterCache      rocontrollers.ClusterCache
-	clusterController rocontrollers.ClusterController
-	secretCache       corecontrollers.SecretCache
-	secretClient      corecontrollers.SecretClient
-	capiClusters      capicontrollers.ClusterCache
-	rkeControlPlane   rkecontroller.RKEControlPlaneCache
+	dynamic            *dynamic.Controller
+	dynamicSchema      mgmtcontroller.DynamicSchemaCache
+	clusterCache       rocontrollers.ClusterCache
+	clusterController  rocontrollers.ClusterController
+	secretCache        corecontrollers.SecretCache
+	secretClient       corecontrollers.SecretClient
+	capiClusters       capicontrollers.ClusterCache
+	machineSets        capicontrollers.MachineSetCache
+	machineDeployments capicontrollers.MachineDeploymentCache
+	machines           capicontrollers.MachineCache
+	machineClient      capicontrollers.MachineClient
+	rkeControlPlane    rkecontroller.RKEControlPlaneCache
 }
 
 func Register(ctx context.Context, clients *clients.Clients) {
 	h := handler{
-		dynamic:           clients.Dynamic,
-		dynamicSchema:     clients.Management.DynamicSchema().Cache(),
-		secretCache:       clients.Core.Secret().Cache(),
-		secretClient:      clients.Core.Secret(),
-		clusterCache:      clients.Cluster.Cluster().Cache(),
-		clusterController: clients.Cluster.Cluster(),
-		capiClusters:      clients.CAPI.Cluster().Cache(),
-		rkeControlPlane:   clients.RKE.RKEControlPlane().Cache(),
+		dynamic:            clients.Dynamic,
+		dynamicSchema:      clients.Management.DynamicSchema().Cache(),
+		secretCache:        clients.Core.Secret().Cache(),
+		secretClient:       clients.Core.Secret(),
+		clusterCache:       clients.Cluster.Cluster().Cache(),
+		clusterController:  clients.Cluster.Cluster(),
+		capiClusters:       clients.CAPI.Cluster().Cache(),
+		machineSets:        clients.CAPI.MachineSet().Cache(),
+		machineDeployments: clients.CAPI.MachineDeployment().Cache(),
+		machines:           clients.CAPI.Machine().Cache(),
+		machineClient:      clients.CAPI.Machine(),
+		rkeControlPlane:    clients.RKE.RKEControlPlane().Cache(),
 	}
 
 	clients.Dynamic.OnChange(ctx, "rke", matchRKENodeGroup, h.infraWatch)
@@ -61,13 +76,26 @@ func Register(ctx context.Context, clients *clients.Clients) {
 			WithCacheTypes(
 				clients.CAPI.Cluster(),
 				clients.CAPI.MachineDeployment(),
+				clients.CAPI.MachineHealthCheck(),
 				clients.RKE.RKECluster(),
+				clients.RKE.RKEControlPlane(),
 				clients.RKE.RKEBootstrapTemplate(),
 			),
 		"RKECluster",
 		"rke-cluster",
 		h.OnRancherClusterChange,
 		nil)
+
+	// machine templates of old node pool revisions are removed once CAPI deleted the MachineSets using them
+	relatedresource.Watch(ctx, "rke-cluster-machine-sets", func(namespace, name string, obj runtime.Object) ([]relatedresource.Key, error) {
+		if machineSet, ok := obj.(*capi.MachineSet); ok {
+			return []relatedresource.Key{{
+				Namespace: machineSet.Namespace,
+				Name:      machineSet.Spec.ClusterName,
+			}}, nil
+		}
+		return nil, nil
+	}, clients.Cluster.Cluster(), clients.CAPI.MachineSet())
 }
 
 func byNodeInfraIndex(obj *rancherv1.Cluster) ([]string, error) {
@@ -141,8 +169,170 @@ func (h *handler) OnRancherClusterChange(obj *rancherv1.Cluster, status rancherv
 		return nil, status, err
 	}
 
-	objs, err := objects(obj, h.dynamic, h.dynamicSchema)
-	return objs, status, err
+	objs, err := Objects(obj, h.dynamic, h.dynamicSchema)
+	if err != nil {
+		return nil, status, err
+	}
+
+	if err := h.keepLegacyMachineTemplates(objs); err != nil {
+		return nil, status, err
+	}
+
+	if err := h.keepAutoscaledReplicas(objs); err != nil {
+		return nil, status, err
+	}
+
+	if err := h.markMachinesToDelete(obj, objs); err != nil {
+		return nil, status, err
+	}
+
+	referenced, err := h.referencedMachineTemplates(obj, objs)
+	return append(objs, referenced...), status, err
+}
+
+// keepAutoscaledReplicas sets the replicas of autoscaled MachineDeployments to the count chosen by the autoscaler
+// so that the quantity of the node pool doesn't overwrite it.
+func (h *handler) keepAutoscaledReplicas(objs []runtime.Object) error {
+	for _, obj := range objs {
+		machineDeployment, ok := obj.(*capi.MachineDeployment)
+		if !ok || machineDeployment.Annotations[autoscalerMinSizeAnnotation] == "" {
+			continue
+		}
+
+		existing, err := h.machineDeployments.Get(machineDeployment.Namespace, machineDeployment.Name)
+		if apierror.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		machineDeployment.Spec.Replicas, err = autoscaledReplicas(machineDeployment, existing.Spec.Replicas)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keepLegacyMachineTemplates keeps using the machine template of node pools that were created before templates
+// were named after their content, as long as the content of the pool is unchanged. Switching the MachineDeployment
+// to the new name would roll all machines of the pool without any change to them.
+func (h *handler) keepLegacyMachineTemplates(objs []runtime.Object) error {
+	templates := map[string]*unstructured.Unstructured{}
+	for _, obj := range objs {
+		if template, ok := obj.(*unstructured.Unstructured); ok && template.GetAPIVersion() == "rke-node.cattle.io/v1" {
+			templates[template.GetName()] = template
+		}
+	}
+
+	for _, obj := range objs {
+		machineDeployment, ok := obj.(*capi.MachineDeployment)
+		if !ok {
+			continue
+		}
+
+		ref := &machineDeployment.Spec.Template.Spec.InfrastructureRef
+		template := templates[ref.Name]
+		if template == nil || ref.Name == machineDeployment.Name {
+			continue
+		}
+
+		existing, err := h.machineDeployments.Get(machineDeployment.Namespace, machineDeployment.Name)
+		if apierror.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		// legacy templates are named like the MachineDeployment
+		existingRef := existing.Spec.Template.Spec.InfrastructureRef
+		if existingRef.Name != machineDeployment.Name || existingRef.Kind != ref.Kind || existingRef.APIVersion != ref.APIVersion {
+			continue
+		}
+
+		legacy, err := h.dynamic.Get(schema.FromAPIVersionAndKind(ref.APIVersion, ref.Kind), machineDeployment.Namespace, existingRef.Name)
+		if apierror.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		legacyData, err := util.ToMap(legacy)
+		if err != nil {
+			return err
+		}
+
+		if same, err := sameJSON(legacyData["spec"], template.Object["spec"]); err != nil {
+			return err
+		} else if same {
+			template.SetName(existingRef.Name)
+			ref.Name = existingRef.Name
+		}
+	}
+
+	return nil
+}
+
+func sameJSON(a, b interface{}) (bool, error) {
+	aData, err := json.Marshal(a)
+	if err != nil {
+		return false, err
+	}
+	bData, err := json.Marshal(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(aData, bData), nil
+}
+
+// referencedMachineTemplates returns the machine templates of previous node pool revisions that are still used by a
+// MachineSet. They are kept until CAPI removes the MachineSets, after that they are garbage-collected by apply.
+func (h *handler) referencedMachineTemplates(cluster *rancherv1.Cluster, objs []runtime.Object) (result []runtime.Object, _ error) {
+	templates := map[string]bool{}
+	for _, obj := range objs {
+		if machineDeployment, ok := obj.(*capi.MachineDeployment); ok {
+			templates[machineDeployment.Spec.Template.Spec.InfrastructureRef.Name] = true
+		}
+	}
+
+	machineSets, err := h.machineSets.List(cluster.Namespace, labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, machineSet := range machineSets {
+		ref := machineSet.Spec.Template.Spec.InfrastructureRef
+		if machineSet.Spec.ClusterName != cluster.Name || ref.APIVersion != "rke-node.cattle.io/v1" || templates[ref.Name] {
+			continue
+		}
+		templates[ref.Name] = true
+
+		template, err := h.dynamic.Get(schema.FromAPIVersionAndKind(ref.APIVersion, ref.Kind), machineSet.Namespace, ref.Name)
+		if apierror.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		data, err := util.ToMap(template)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"kind":       ref.Kind,
+				"apiVersion": ref.APIVersion,
+				"metadata": map[string]interface{}{
+					"name":      ref.Name,
+					"namespace": machineSet.Namespace,
+				},
+				"spec": data["spec"],
+			},
+		})
+	}
+
+	return result, nil
 }
 
 func (h *handler) updateClusterProvisioningStatus(cluster *rancherv1.Cluster, status rancherv1.ClusterStatus) (rancherv1.ClusterStatus, error) {
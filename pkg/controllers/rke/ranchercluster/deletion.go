@@ -0,0 +1,141 @@
+package ranchercluster
+
+import (
+	"fmt"
+	"sort"
+
+	rancherv1 "github.com/rancher/rancher-operator/pkg/apis/rancher.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/planner"
+	apierror "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+)
+
+func deletePolicy(nodePool rancherv1.RKENodePool) (*string, error) {
+	switch capi.MachineSetDeletePolicy(nodePool.DeletePolicy) {
+	case "":
+		return nil, nil
+	case capi.RandomMachineSetDeletePolicy, capi.NewestMachineSetDeletePolicy, capi.OldestMachineSetDeletePolicy:
+		return &nodePool.DeletePolicy, nil
+	default:
+		return nil, fmt.Errorf("invalid delete policy %q of node pool %s, must be one of Random, Newest or Oldest",
+			nodePool.DeletePolicy, nodePool.Name)
+	}
+}
+
+// markMachinesToDelete annotates the machines that CAPI has to remove when the replicas of a MachineDeployment are
+// lowered, nothing is annotated otherwise. The machines named by the node pool go first, followed by the machines
+// picked by the delete policy. The init node goes last so that a new init node doesn't have to be elected while
+// other machines can be removed.
+func (h *handler) markMachinesToDelete(cluster *rancherv1.Cluster, objs []runtime.Object) error {
+	nodePools := map[string]rancherv1.RKENodePool{}
+	for _, nodePool := range cluster.Spec.RKEConfig.NodePools {
+		nodePools[nodePoolName(cluster, nodePool)] = nodePool
+	}
+
+	for _, obj := range objs {
+		machineDeployment, ok := obj.(*capi.MachineDeployment)
+		if !ok || machineDeployment.Spec.Replicas == nil {
+			continue
+		}
+
+		existing, err := h.machineDeployments.Get(machineDeployment.Namespace, machineDeployment.Name)
+		if apierror.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		// CAPI defaults the replicas to one
+		existingReplicas := int32(1)
+		if existing.Spec.Replicas != nil {
+			existingReplicas = *existing.Spec.Replicas
+		}
+		if *machineDeployment.Spec.Replicas >= existingReplicas {
+			continue
+		}
+
+		nodePool := nodePools[machineDeployment.Name]
+		toDelete := sets.NewString(nodePool.MachinesToDelete...)
+
+		machines, err := h.machines.List(machineDeployment.Namespace, labels.SelectorFromSet(map[string]string{
+			capi.MachineDeploymentLabelName: machineDeployment.Name,
+		}))
+		if err != nil {
+			return err
+		}
+
+		var (
+			remaining   []*capi.Machine
+			hasInitNode bool
+		)
+		for _, machine := range machines {
+			if machine.DeletionTimestamp == nil {
+				remaining = append(remaining, machine)
+				hasInitNode = hasInitNode || machine.Labels[planner.InitNodeLabel] == "true"
+			}
+		}
+
+		sortMachinesToDelete(remaining, nodePool.DeletePolicy, toDelete)
+
+		excess := len(remaining) - int(*machineDeployment.Spec.Replicas)
+		for i, machine := range remaining {
+			// only as many machines as the replicas are lowered by are removed, CAPI applies the delete policy by
+			// itself unless the init node has to be kept
+			if i >= excess || (!toDelete.Has(machine.Name) && !hasInitNode) {
+				break
+			}
+			if _, ok := machine.Annotations[capi.DeleteMachineAnnotation]; ok {
+				continue
+			}
+			machine = machine.DeepCopy()
+			if machine.Annotations == nil {
+				machine.Annotations = map[string]string{}
+			}
+			machine.Annotations[capi.DeleteMachineAnnotation] = "yes"
+			if _, err := h.machineClient.Update(machine); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// sortMachinesToDelete orders machines by how early they should be removed.
+func sortMachinesToDelete(machines []*capi.Machine, policy string, toDelete sets.String) {
+	priority := func(machine *capi.Machine) int {
+		switch {
+		case toDelete.Has(machine.Name):
+			return 0
+		case machine.Annotations[capi.DeleteMachineAnnotation] != "":
+			return 1
+		case machine.Status.NodeRef == nil || machine.Status.FailureReason != nil || machine.Status.FailureMessage != nil:
+			return 2
+		case machine.Labels[planner.InitNodeLabel] == "true":
+			return 4
+		default:
+			return 3
+		}
+	}
+
+	sort.SliceStable(machines, func(i, j int) bool {
+		if pi, pj := priority(machines[i]), priority(machines[j]); pi != pj {
+			return pi < pj
+		}
+		ti, tj := machines[i].CreationTimestamp, machines[j].CreationTimestamp
+		switch capi.MachineSetDeletePolicy(policy) {
+		case capi.NewestMachineSetDeletePolicy:
+			if !ti.Equal(&tj) {
+				return tj.Before(&ti)
+			}
+		case capi.OldestMachineSetDeletePolicy:
+			if !ti.Equal(&tj) {
+				return ti.Before(&tj)
+			}
+		}
+		return machines[i].Name < machines[j].Name
+	})
+}
@@ -1,10 +1,13 @@
 package ranchercluster
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"strings"
+	"time"
 
-	"github.com/rancher/lasso/pkg/dynamic"
 	rancherv1 "github.com/rancher/rancher-operator/pkg/apis/rancher.cattle.io/v1"
 	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
 	mgmtcontroller "github.com/rancher/rancher-operator/pkg/generated/controllers/management.cattle.io/v3"
@@ -19,9 +22,14 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
 )
 
+const (
+	defaultNodeStartupTimeout = 10 * time.Minute
+)
+
 func getInfraRef(rkeCluster *rkev1.RKECluster) *corev1.ObjectReference {
 	gvk, _ := gvk.Get(rkeCluster)
 	infraRef := &corev1.ObjectReference{
@@ -31,7 +39,13 @@ func getInfraRef(rkeCluster *rkev1.RKECluster) *corev1.ObjectReference {
 	return infraRef
 }
 
-func objects(cluster *rancherv1.Cluster, dynamic *dynamic.Controller, dynamicSchema mgmtcontroller.DynamicSchemaCache) (result []runtime.Object, _ error) {
+// NodeConfigGetter looks up the node config referenced by a node pool, it is implemented by the dynamic controller.
+type NodeConfigGetter interface {
+	Get(gvk schema.GroupVersionKind, namespace, name string) (runtime.Object, error)
+}
+
+// Objects returns the objects that are generated for a rancher cluster with an RKE config.
+func Objects(cluster *rancherv1.Cluster, dynamic NodeConfigGetter, dynamicSchema mgmtcontroller.DynamicSchemaCache) (result []runtime.Object, _ error) {
 	infraRef := cluster.Spec.RKEConfig.InfrastructureRef
 	if infraRef == nil {
 		rkeCluster := rkeCluster(cluster)
@@ -71,8 +85,12 @@ func pruneBySchema(kind string, data map[string]interface{}, dynamicSchema mgmtc
 	return nil
 }
 
+// toMachineTemplate returns the machine template of the current revision of the node pool. Templates are named
+// after the hash of their content and never change, a changed node config results in a new template which causes
+// the MachineDeployment to roll its machines. Pools whose template is named after the pool keep it until their
+// content changes, see keepLegacyMachineTemplates.
 func toMachineTemplate(nodePoolName string, cluster *rancherv1.Cluster, nodePool rancherv1.RKENodePool,
-	dynamic *dynamic.Controller, dynamicSchema mgmtcontroller.DynamicSchemaCache) (runtime.Object, error) {
+	dynamic NodeConfigGetter, dynamicSchema mgmtcontroller.DynamicSchemaCache) (*unstructured.Unstructured, error) {
 	apiVersion := nodePool.NodeConfig.APIVersion
 	kind := nodePool.NodeConfig.Kind
 	if apiVersion == "" {
@@ -94,6 +112,11 @@ func toMachineTemplate(nodePoolName string, cluster *rancherv1.Cluster, nodePool
 		return nil, err
 	}
 
+	var annotations map[string]string
+	if nodePool.Autoscaling != nil {
+		annotations = autoscalerCapacityAnnotations(nodePool.Autoscaling, nodePoolData)
+	}
+
 	commonData, err := convert.EncodeToMap(nodePool.RKECommonNodeConfig)
 	if err != nil {
 		return nil, err
@@ -104,12 +127,18 @@ func toMachineTemplate(nodePoolName string, cluster *rancherv1.Cluster, nodePool
 		nodePoolData.SetNested(cluster.Spec.CloudCredentialSecretName, "common", "cloudCredentialSecretName")
 	}
 
-	return &unstructured.Unstructured{
+	data, err := json.Marshal(nodePoolData)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(data)
+
+	machineTemplate := &unstructured.Unstructured{
 		Object: map[string]interface{}{
 			"kind":       strings.TrimSuffix(kind, "Config") + "MachineTemplate",
 			"apiVersion": "rke-node.cattle.io/v1",
 			"metadata": map[string]interface{}{
-				"name":      nodePoolName,
+				"name":      name.SafeConcatName(nodePoolName, hex.EncodeToString(hash[:])[:10]),
 				"namespace": cluster.Namespace,
 			},
 			"spec": map[string]interface{}{
@@ -118,10 +147,14 @@ func toMachineTemplate(nodePoolName string, cluster *rancherv1.Cluster, nodePool
 				},
 			},
 		},
-	}, nil
+	}
+	if len(annotations) > 0 {
+		machineTemplate.SetAnnotations(annotations)
+	}
+	return machineTemplate, nil
 }
 
-func machineDeployments(cluster *rancherv1.Cluster, capiCluster *capi.Cluster, dynamic *dynamic.Controller,
+func machineDeployments(cluster *rancherv1.Cluster, capiCluster *capi.Cluster, dynamic NodeConfigGetter,
 	dynamicSchema mgmtcontroller.DynamicSchemaCache) (result []runtime.Object, _ error) {
 	bootstrapName := name.SafeConcatName(cluster.Name, "bootstrap", "template")
 
@@ -139,7 +172,7 @@ func machineDeployments(cluster *rancherv1.Cluster, capiCluster *capi.Cluster, d
 			continue
 		}
 
-		nodePoolName := name.SafeConcatName(cluster.Name, "nodepool", nodePool.Name)
+		nodePoolName := nodePoolName(cluster, nodePool)
 
 		machineTemplate, err := toMachineTemplate(nodePoolName, cluster, nodePool, dynamic, dynamicSchema)
 		if err != nil {
@@ -175,9 +208,9 @@ func machineDeployments(cluster *rancherv1.Cluster, capiCluster *capi.Cluster, d
 							},
 						},
 						InfrastructureRef: corev1.ObjectReference{
-							Kind:       machineTemplate.GetObjectKind().GroupVersionKind().Kind,
+							Kind:       machineTemplate.GetKind(),
 							Namespace:  cluster.Namespace,
-							Name:       nodePoolName,
+							Name:       machineTemplate.GetName(),
 							APIVersion: "rke-node.cattle.io/v1",
 						},
 					},
@@ -185,15 +218,34 @@ func machineDeployments(cluster *rancherv1.Cluster, capiCluster *capi.Cluster, d
 				Paused: nodePool.Paused,
 			},
 		}
-		if nodePool.RollingUpdate != nil {
+		if nodePool.Autoscaling != nil {
+			if err := validateAutoscaling(nodePool.Autoscaling); err != nil {
+				return nil, fmt.Errorf("invalid autoscaling of node pool %s: %w", nodePool.Name, err)
+			}
+			machineDeployment.Annotations = autoscalerSizeAnnotations(nodePool.Autoscaling)
+			machineDeployment.Spec.Replicas, err = autoscaledReplicas(machineDeployment, nil)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		deletePolicy, err := deletePolicy(nodePool)
+		if err != nil {
+			return nil, err
+		}
+
+		if nodePool.RollingUpdate != nil || deletePolicy != nil {
 			machineDeployment.Spec.Strategy = &capi.MachineDeploymentStrategy{
 				Type: capi.RollingUpdateMachineDeploymentStrategyType,
 				RollingUpdate: &capi.MachineRollingUpdateDeployment{
-					MaxUnavailable: nodePool.RollingUpdate.MaxUnavailable,
-					MaxSurge:       nodePool.RollingUpdate.MaxSurge,
+					DeletePolicy: deletePolicy,
 				},
 			}
 		}
+		if nodePool.RollingUpdate != nil {
+			machineDeployment.Spec.Strategy.RollingUpdate.MaxUnavailable = nodePool.RollingUpdate.MaxUnavailable
+			machineDeployment.Spec.Strategy.RollingUpdate.MaxSurge = nodePool.RollingUpdate.MaxSurge
+		}
 
 		if defaultTrue(nodePool.EtcdRole) {
 			machineDeployment.Spec.Template.Labels[planner.EtcdRoleLabel] = "true"
@@ -217,11 +269,84 @@ func machineDeployments(cluster *rancherv1.Cluster, capiCluster *capi.Cluster, d
 		}
 
 		result = append(result, machineDeployment)
+
+		if nodePool.HealthCheck != nil {
+			healthCheck, err := machineHealthCheck(nodePoolName, capiCluster, nodePool.HealthCheck)
+			if err != nil {
+				return nil, fmt.Errorf("invalid health check of node pool %s: %w", nodePool.Name, err)
+			}
+			result = append(result, healthCheck)
+		}
 	}
 
 	return result, nil
 }
 
+// machineHealthCheck returns the MachineHealthCheck selecting the machines of the MachineDeployment of a node pool.
+func machineHealthCheck(nodePoolName string, capiCluster *capi.Cluster, healthCheck *rancherv1.RKEMachinePoolHealthCheck) (*capi.MachineHealthCheck, error) {
+	result := &capi.MachineHealthCheck{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: capiCluster.Namespace,
+			Name:      nodePoolName,
+		},
+		Spec: capi.MachineHealthCheckSpec{
+			ClusterName: capiCluster.Name,
+			Selector: metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					capi.MachineDeploymentLabelName: nodePoolName,
+				},
+			},
+			MaxUnhealthy: healthCheck.MaxUnhealthy,
+			// the CAPI controller expects both to be set
+			NodeStartupTimeout: &metav1.Duration{Duration: defaultNodeStartupTimeout},
+		},
+	}
+
+	if result.Spec.MaxUnhealthy == nil {
+		maxUnhealthy := intstr.FromString("100%")
+		result.Spec.MaxUnhealthy = &maxUnhealthy
+	}
+
+	if healthCheck.NodeStartupTimeout != "" {
+		timeout, err := time.ParseDuration(healthCheck.NodeStartupTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid node startup timeout %q: %w", healthCheck.NodeStartupTimeout, err)
+		}
+		result.Spec.NodeStartupTimeout = &metav1.Duration{Duration: timeout}
+	}
+
+	for _, condition := range healthCheck.UnhealthyConditions {
+		if condition.Type == "" || condition.Status == "" {
+			return nil, fmt.Errorf("unhealthy conditions require a type and status")
+		}
+		timeout, err := time.ParseDuration(condition.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout %q of unhealthy condition %s: %w", condition.Timeout, condition.Type, err)
+		}
+		result.Spec.UnhealthyConditions = append(result.Spec.UnhealthyConditions, capi.UnhealthyCondition{
+			Type:    condition.Type,
+			Status:  condition.Status,
+			Timeout: metav1.Duration{Duration: timeout},
+		})
+	}
+
+	if len(result.Spec.UnhealthyConditions) == 0 {
+		for _, status := range []corev1.ConditionStatus{corev1.ConditionFalse, corev1.ConditionUnknown} {
+			result.Spec.UnhealthyConditions = append(result.Spec.UnhealthyConditions, capi.UnhealthyCondition{
+				Type:    corev1.NodeReady,
+				Status:  status,
+				Timeout: metav1.Duration{Duration: 5 * time.Minute},
+			})
+		}
+	}
+
+	return result, nil
+}
+
+func nodePoolName(cluster *rancherv1.Cluster, nodePool rancherv1.RKENodePool) string {
+	return name.SafeConcatName(cluster.Name, "nodepool", nodePool.Name)
+}
+
 func defaultTrue(b *bool) bool {
 	if b == nil {
 		return true
@@ -254,9 +379,7 @@ func rkeControlPlane(cluster *rancherv1.Cluster) *rkev1.RKEControlPlane {
 			Namespace: cluster.Namespace,
 		},
 		Spec: rkev1.RKEControlPlaneSpec{
-			RKEClusterSpecCommon: rkev1.RKEClusterSpecCommon{
-				UpgradeStrategy: rkev1.ClusterUpgradeStrategy{},
-			},
+			RKEClusterSpecCommon:  *cluster.Spec.RKEConfig.RKEClusterSpecCommon.DeepCopy(),
 			KubernetesVersion:     cluster.Spec.KubernetesVersion,
 			ManagementClusterName: cluster.Status.ClusterName,
 		},
@@ -0,0 +1,76 @@
+package ranchercluster
+
+import (
+	"testing"
+	"time"
+
+	rancherv1 "github.com/rancher/rancher-operator/pkg/apis/rancher.cattle.io/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+)
+
+func TestMachineHealthCheck(t *testing.T) {
+	capiCluster := &capi.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: "fleet-default", Name: "test"}}
+	fortyPercent := intstr.FromString("40%")
+
+	tests := []struct {
+		name                       string
+		healthCheck                rancherv1.RKEMachinePoolHealthCheck
+		expectedNodeStartupTimeout time.Duration
+		expectedMaxUnhealthy       string
+		expectedConditions         int
+		expectedErr                bool
+	}{
+		{
+			name:                       "defaults",
+			expectedNodeStartupTimeout: defaultNodeStartupTimeout,
+			expectedMaxUnhealthy:       "100%",
+			expectedConditions:         2,
+		},
+		{
+			name: "configured",
+			healthCheck: rancherv1.RKEMachinePoolHealthCheck{
+				UnhealthyConditions: []rancherv1.RKEMachinePoolUnhealthyCondition{
+					{Type: corev1.NodeReady, Status: corev1.ConditionFalse, Timeout: "10m"},
+				},
+				NodeStartupTimeout: "15m",
+				MaxUnhealthy:       &fortyPercent,
+			},
+			expectedNodeStartupTimeout: 15 * time.Minute,
+			expectedMaxUnhealthy:       "40%",
+			expectedConditions:         1,
+		},
+		{
+			name:        "invalid node startup timeout",
+			healthCheck: rancherv1.RKEMachinePoolHealthCheck{NodeStartupTimeout: "15 minutes"},
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			healthCheck, err := machineHealthCheck("test-pool", capiCluster, &test.healthCheck)
+			if test.expectedErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			spec := healthCheck.Spec
+			if spec.NodeStartupTimeout == nil || spec.NodeStartupTimeout.Duration != test.expectedNodeStartupTimeout {
+				t.Errorf("node startup timeout = %v, expected %v", spec.NodeStartupTimeout, test.expectedNodeStartupTimeout)
+			}
+			if spec.MaxUnhealthy == nil || spec.MaxUnhealthy.String() != test.expectedMaxUnhealthy {
+				t.Errorf("max unhealthy = %v, expected %s", spec.MaxUnhealthy, test.expectedMaxUnhealthy)
+			}
+			if len(spec.UnhealthyConditions) != test.expectedConditions {
+				t.Errorf("got %d unhealthy conditions, expected %d", len(spec.UnhealthyConditions), test.expectedConditions)
+			}
+		})
+	}
+}
@@ -2,13 +2,18 @@ package crd
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"reflect"
+	"strings"
 
 	v1 "github.com/rancher/rancher-operator/pkg/apis/rancher.cattle.io/v1"
 	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
 	"github.com/rancher/wrangler/pkg/crd"
 	"github.com/rancher/wrangler/pkg/data"
+	"github.com/rancher/wrangler/pkg/schemas/openapi"
 	"github.com/rancher/wrangler/pkg/yaml"
+	apiextv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/rest"
@@ -31,6 +36,7 @@ func List() []crd.CRD {
 func operator() []crd.CRD {
 	return []crd.CRD{
 		newRancherCRD(&v1.Cluster{}, func(c crd.CRD) crd.CRD {
+			c = withIntOrString(c, upgradeConcurrency("spec", "rkeConfig", "upgradeStrategy")...)
 			return c.
 				WithColumn("Ready", ".status.ready").
 				WithColumn("Kubeconfig", ".status.clientSecretName")
@@ -54,6 +60,7 @@ func operator() []crd.CRD {
 			return c
 		}),
 		newRKECRD(&rkev1.RKEControlPlane{}, func(c crd.CRD) crd.CRD {
+			c = withIntOrString(c, upgradeConcurrency("spec", "upgradeStrategy")...)
 			c.Labels = map[string]string{
 				"cluster.x-k8s.io/v1alpha4": "v1",
 			}
@@ -72,6 +79,7 @@ func operator() []crd.CRD {
 			return c
 		}),
 		newRKECRD(&rkev1.RKEControlPlane{}, func(c crd.CRD) crd.CRD {
+			c = withIntOrString(c, upgradeConcurrency("spec", "upgradeStrategy")...)
 			c.Labels = map[string]string{
 				"cluster.x-k8s.io/v1alpha4": "v1",
 			}
@@ -116,6 +124,58 @@ func capi() []crd.CRD {
 	return result
 }
 
+// upgradeConcurrency returns the paths of the concurrency fields of the upgrade strategy at the given path.
+func upgradeConcurrency(path ...string) [][]string {
+	return [][]string{
+		append(append([]string{}, path...), "serverConcurrency"),
+		append(append([]string{}, path...), "workerConcurrency"),
+	}
+}
+
+// withIntOrString replaces the generated schema of the fields at the given paths to accept both integers and
+// strings. The schema generated for an IntOrString only accepts strings, which would reject objects written
+// while those fields were integers.
+func withIntOrString(c crd.CRD, paths ...[]string) crd.CRD {
+	schema, err := openapi.ToOpenAPIFromStruct(c.SchemaObject)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, path := range paths {
+		if err := setSchema(schema, path, apiextv1beta1.JSONSchemaProps{
+			XIntOrString: true,
+			Nullable:     true,
+		}); err != nil {
+			panic(err)
+		}
+	}
+
+	// the kind is derived from the schema object if it is not set
+	if c.GVK.Kind == "" {
+		c.GVK.Kind = reflect.Indirect(reflect.ValueOf(c.SchemaObject)).Type().Name()
+	}
+	c.Schema = schema
+	c.SchemaObject = nil
+	return c
+}
+
+func setSchema(schema *apiextv1beta1.JSONSchemaProps, path []string, value apiextv1beta1.JSONSchemaProps) error {
+	if len(path) == 1 {
+		schema.Properties[path[0]] = value
+		return nil
+	}
+
+	child, ok := schema.Properties[path[0]]
+	if !ok {
+		return fmt.Errorf("no schema for %s", strings.Join(path, "."))
+	}
+	if err := setSchema(&child, path[1:], value); err != nil {
+		return err
+	}
+	schema.Properties[path[0]] = child
+	return nil
+}
+
 func newRKECRD(obj interface{}, customize func(crd.CRD) crd.CRD) crd.CRD {
 	crd := crd.CRD{
 		GVK: schema.GroupVersionKind{
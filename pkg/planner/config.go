@@ -0,0 +1,133 @@
+package planner
+
+import (
+	"encoding/json"
+	"strings"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+)
+
+const (
+	EffectiveConfigAnnotation = "rke.cattle.io/effective-config"
+
+	redactedConfigValue = "<redacted>"
+)
+
+var (
+	// config keys ending in one of these suffixes hold credentials, the datastore endpoint may contain a password
+	sensitiveConfigKeySuffixes = []string{"token", "secret", "password", "-key", "datastore-endpoint"}
+)
+
+// nodeLabels returns the labels that are assigned to the node of the machine.
+func nodeLabels(machine *capi.Machine) (map[string]string, error) {
+	result := map[string]string{}
+	if data := machine.Annotations[LabelsAnnotation]; data != "" {
+		if err := json.Unmarshal([]byte(data), &result); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// machineConfig merges all RKESystemConfig entries that apply to the machine. Entries with neither a
+// selector nor a machine name are applied first, then entries whose selector matches the labels of
+// the machine or its node and last entries naming the machine. Within each level entries are applied
+// in order and keys of later entries override keys of earlier entries. The typed runtime config of an
+// entry is applied before its free-form config.
+func machineConfig(controlPlane *rkev1.RKEControlPlane, machine *capi.Machine) (map[string]interface{}, error) {
+	machineLabels, err := nodeLabels(machine)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range machine.Labels {
+		machineLabels[k] = v
+	}
+
+	var global, selected, named []rkev1.RKESystemConfig
+	for _, opts := range controlPlane.Spec.Config {
+		if opts.MachineLabelSelector != nil {
+			sel, err := metav1.LabelSelectorAsSelector(opts.MachineLabelSelector)
+			if err != nil {
+				return nil, err
+			}
+			if !sel.Matches(labels.Set(machineLabels)) {
+				continue
+			}
+		}
+
+		switch {
+		case opts.MachineName != "":
+			if opts.MachineName == machine.Name {
+				named = append(named, opts)
+			}
+		case opts.MachineLabelSelector != nil:
+			selected = append(selected, opts)
+		default:
+			global = append(global, opts)
+		}
+	}
+
+	runtime := GetRuntime(controlPlane.Spec.KubernetesVersion)
+	result := map[string]interface{}{}
+	for _, opts := range append(append(global, selected...), named...) {
+		typed, err := runtimeConfigData(runtime, opts.RuntimeConfig)
+		if err != nil {
+			return nil, err
+		}
+		config := opts.Config.DeepCopy().Data
+		if err := validateConfigKeys(config); err != nil {
+			return nil, err
+		}
+		for k, v := range typed {
+			result[k] = v
+		}
+		for k, v := range config {
+			result[k] = v
+		}
+	}
+
+	return result, nil
+}
+
+// recordEffectiveConfig stores the merged config of the machine in an annotation so that it can be inspected. Values
+// read from secrets are recorded as their reference, the values of sensitive keys are redacted.
+func (p *Planner) recordEffectiveConfig(controlPlane *rkev1.RKEControlPlane, machine *capi.Machine) (*capi.Machine, error) {
+	config, err := machineConfig(controlPlane, machine)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(redactConfig(config))
+	if err != nil {
+		return nil, err
+	}
+
+	if machine.Annotations[EffectiveConfigAnnotation] == string(data) {
+		return machine, nil
+	}
+
+	return p.updateMachineAnnotations(machine, map[string]string{
+		EffectiveConfigAnnotation: string(data),
+	})
+}
+
+// redactConfig replaces the values of keys that hold credentials, references to secrets are kept.
+func redactConfig(config map[string]interface{}) map[string]interface{} {
+	result := map[string]interface{}{}
+	for key, value := range config {
+		result[key] = value
+		if ref, err := configValueFrom(value); err == nil && ref != nil {
+			continue
+		}
+		for _, suffix := range sensitiveConfigKeySuffixes {
+			if strings.HasSuffix(key, suffix) {
+				result[key] = redactedConfigValue
+				break
+			}
+		}
+	}
+	return result
+}
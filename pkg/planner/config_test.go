@@ -0,0 +1,42 @@
+package planner
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+func TestRedactConfig(t *testing.T) {
+	secretRef := map[string]interface{}{
+		"valueFrom": map[string]interface{}{
+			"secretKeyRef": map[string]interface{}{"name": "s3", "key": "secretKey"},
+		},
+	}
+
+	config := map[string]interface{}{
+		"cni":                "calico",
+		"token":              "server-token",
+		"agent-token":        "agent-token",
+		"etcd-s3-access-key": "access",
+		"etcd-s3-secret-key": secretRef,
+		"datastore-endpoint": "postgres://user:password@db:5432/k3s",
+		"tls-san":            []interface{}{"rancher.example.com"},
+	}
+
+	expected := map[string]interface{}{
+		"cni":                "calico",
+		"token":              redactedConfigValue,
+		"agent-token":        redactedConfigValue,
+		"etcd-s3-access-key": redactedConfigValue,
+		"etcd-s3-secret-key": secretRef,
+		"datastore-endpoint": redactedConfigValue,
+		"tls-san":            []interface{}{"rancher.example.com"},
+	}
+
+	if actual := redactConfig(config); !equality.Semantic.DeepEqual(actual, expected) {
+		t.Errorf("redactConfig() = %v, expected %v", actual, expected)
+	}
+	if config["token"] != "server-token" {
+		t.Errorf("redactConfig() modified the config")
+	}
+}
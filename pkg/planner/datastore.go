@@ -0,0 +1,87 @@
+package planner
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	datastoreEndpointKey = "endpoint"
+	datastoreTLSDir      = "/var/lib/rancher/%s/server/tls/datastore"
+)
+
+func usesExternalDatastore(controlPlane *rkev1.RKEControlPlane) bool {
+	return controlPlane.Spec.Datastore != nil
+}
+
+// initNodeRole returns the machines the init node is elected from. Without etcd every control plane machine can
+// serve as the join server of the agents.
+func initNodeRole(controlPlane *rkev1.RKEControlPlane) roleFilter {
+	if usesExternalDatastore(controlPlane) {
+		return isControlPlane
+	}
+	return isEtcd
+}
+
+// validateDatastore checks that the cluster topology and the requested operations work with an external datastore.
+func validateDatastore(controlPlane *rkev1.RKEControlPlane, clusterPlan *plan.Plan) error {
+	if !usesExternalDatastore(controlPlane) {
+		return nil
+	}
+
+	if runtime := GetRuntime(controlPlane.Spec.KubernetesVersion); runtime != RuntimeK3S {
+		return fmt.Errorf("an external datastore is only supported by %s, not %s", RuntimeK3S, runtime)
+	}
+	if controlPlane.Spec.Datastore.SecretName == "" {
+		return fmt.Errorf("the secret name of the external datastore is required")
+	}
+	if entries, _ := collect(clusterPlan, isEtcd); len(entries) > 0 {
+		return fmt.Errorf("clusters using an external datastore can not have etcd machines, found %s", entries[0].Machine.Name)
+	}
+	if etcdSnapshotCreateGeneration(controlPlane) > 0 || controlPlane.Spec.ETCDSnapshotRestore != nil {
+		return fmt.Errorf("etcd snapshots are not supported with an external datastore")
+	}
+	return nil
+}
+
+// addDatastoreConfig points a server to the external datastore. Certificates of the datastore secret are written
+// as separate files.
+func (p *Planner) addDatastoreConfig(controlPlane *rkev1.RKEControlPlane, config map[string]interface{}, nodePlan *plan.NodePlan) error {
+	secret, err := p.secretCache.Get(controlPlane.Namespace, controlPlane.Spec.Datastore.SecretName)
+	if err != nil {
+		return err
+	}
+
+	endpoint := string(secret.Data[datastoreEndpointKey])
+	if endpoint == "" {
+		return fmt.Errorf("secret %s of the external datastore has no %s key", secret.Name, datastoreEndpointKey)
+	}
+	config["datastore-endpoint"] = endpoint
+
+	dir := fmt.Sprintf(datastoreTLSDir, GetRuntime(controlPlane.Spec.KubernetesVersion))
+	for _, file := range []struct {
+		key       string
+		configKey string
+	}{
+		{key: "ca.crt", configKey: "datastore-cafile"},
+		{key: corev1.TLSCertKey, configKey: "datastore-certfile"},
+		{key: corev1.TLSPrivateKeyKey, configKey: "datastore-keyfile"},
+	} {
+		if len(secret.Data[file.key]) == 0 {
+			continue
+		}
+		path := dir + "/" + file.key
+		nodePlan.Files = append(nodePlan.Files, plan.File{
+			Content:     base64.StdEncoding.EncodeToString(secret.Data[file.key]),
+			Path:        path,
+			Permissions: "0600",
+		})
+		config[file.configKey] = path
+	}
+
+	return nil
+}
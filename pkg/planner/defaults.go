@@ -0,0 +1,19 @@
+package planner
+
+import (
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+)
+
+// setDefaults fills in the unset fields of the spec of the control plane. This is the only place the defaults are
+// applied, the rancher Cluster and the RKEControlPlane keep the values as they were entered so that changing a
+// default reaches existing clusters. The control plane must be a copy owned by the caller.
+func setDefaults(controlPlane *rkev1.RKEControlPlane) {
+	strategy := &controlPlane.Spec.UpgradeStrategy
+	if strategy.DrainOptions.IgnoreDaemonSets == nil {
+		ignoreDaemonSets := true
+		strategy.DrainOptions.IgnoreDaemonSets = &ignoreDaemonSets
+	}
+	if strategy.MaintenanceWindowTimeZone == "" {
+		strategy.MaintenanceWindowTimeZone = "UTC"
+	}
+}
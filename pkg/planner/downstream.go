@@ -0,0 +1,20 @@
+package planner
+
+import (
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+func (p *Planner) downstreamClient(controlPlane *rkev1.RKEControlPlane) (kubernetes.Interface, error) {
+	cluster, err := p.rancherClusterCache.Get(controlPlane.Namespace, controlPlane.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := p.kubeconfig.GetRESTConfig(cluster, cluster.Status)
+	if err != nil {
+		return nil, err
+	}
+
+	return kubernetes.NewForConfig(config)
+}
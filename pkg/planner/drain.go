@@ -0,0 +1,220 @@
+package planner
+
+import (
+	"fmt"
+	"time"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	apierror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+)
+
+const (
+	DrainStartedAnnotation = "rke.cattle.io/drain-started"
+	DrainDoneAnnotation    = "rke.cattle.io/drain-done"
+
+	mirrorPodAnnotation = "kubernetes.io/config.mirror"
+
+	drainPollInterval = 10 * time.Second
+)
+
+func shouldDrain(controlPlane *rkev1.RKEControlPlane, machine *capi.Machine) bool {
+	if isServer(machine) {
+		return controlPlane.Spec.UpgradeStrategy.DrainServerNodes
+	}
+	return controlPlane.Spec.UpgradeStrategy.DrainWorkerNodes
+}
+
+func (p *Planner) getNode(client kubernetes.Interface, machine *capi.Machine) (*corev1.Node, error) {
+	nodes, err := client.CoreV1().Nodes().List(p.ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(map[string]string{
+			MachineUIDLabel: string(machine.UID),
+		}).String(),
+	})
+	if err != nil || len(nodes.Items) == 0 {
+		return nil, err
+	}
+	return &nodes.Items[0], nil
+}
+
+func (p *Planner) setUnschedulable(client kubernetes.Interface, node *corev1.Node, unschedulable bool) error {
+	if node.Spec.Unschedulable == unschedulable {
+		return nil
+	}
+	_, err := client.CoreV1().Nodes().Patch(p.ctx, node.Name, types.StrategicMergePatchType,
+		[]byte(fmt.Sprintf(`{"spec":{"unschedulable":%t}}`, unschedulable)), metav1.PatchOptions{})
+	return err
+}
+
+func (p *Planner) updateMachineAnnotations(machine *capi.Machine, set map[string]string, remove ...string) (*capi.Machine, error) {
+	machine = machine.DeepCopy()
+	if machine.Annotations == nil {
+		machine.Annotations = map[string]string{}
+	}
+	for k, v := range set {
+		machine.Annotations[k] = v
+	}
+	for _, k := range remove {
+		delete(machine.Annotations, k)
+	}
+	return p.machines.Update(machine)
+}
+
+// drain cordons the node of the machine and evicts its pods. It returns true once no pods are left that need to be
+// evicted. Draining is not blocking, the control plane is requeued until the node is drained.
+func (p *Planner) drain(controlPlane *rkev1.RKEControlPlane, machine *capi.Machine) (bool, error) {
+	if machine.Annotations[DrainDoneAnnotation] == "true" {
+		return true, nil
+	}
+
+	client, err := p.downstreamClient(controlPlane)
+	if err != nil {
+		return false, err
+	}
+
+	node, err := p.getNode(client, machine)
+	if err != nil {
+		return false, err
+	}
+
+	if node == nil {
+		// the node never registered so there is nothing to drain
+		return true, nil
+	}
+
+	started := machine.Annotations[DrainStartedAnnotation]
+	if started == "" {
+		started = time.Now().UTC().Format(time.RFC3339)
+		machine, err = p.updateMachineAnnotations(machine, map[string]string{
+			DrainStartedAnnotation: started,
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if err := p.setUnschedulable(client, node, true); err != nil {
+		return false, err
+	}
+
+	pods, err := p.podsToEvict(client, node, controlPlane.Spec.UpgradeStrategy.DrainOptions)
+	if err != nil {
+		return false, err
+	}
+
+	if len(pods) == 0 {
+		_, err := p.updateMachineAnnotations(machine, map[string]string{
+			DrainDoneAnnotation: "true",
+		})
+		return err == nil, err
+	}
+
+	opts := controlPlane.Spec.UpgradeStrategy.DrainOptions
+	if opts.Timeout > 0 {
+		startTime, err := time.Parse(time.RFC3339, started)
+		if err == nil && time.Since(startTime) > time.Duration(opts.Timeout)*time.Second {
+			return false, fmt.Errorf("timed out draining node %s of machine %s, %d pod(s) remaining", node.Name, machine.Name, len(pods))
+		}
+	}
+
+	for _, pod := range pods {
+		eviction := &policyv1beta1.Eviction{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      pod.Name,
+				Namespace: pod.Namespace,
+			},
+		}
+		if opts.GracePeriod > 0 {
+			gracePeriod := int64(opts.GracePeriod)
+			eviction.DeleteOptions = &metav1.DeleteOptions{
+				GracePeriodSeconds: &gracePeriod,
+			}
+		}
+		err := client.PolicyV1beta1().Evictions(pod.Namespace).Evict(p.ctx, eviction)
+		// TooManyRequests is returned when a PodDisruptionBudget does not allow the eviction yet
+		if err != nil && !apierror.IsNotFound(err) && !apierror.IsTooManyRequests(err) {
+			return false, err
+		}
+	}
+
+	p.controlPlanes.EnqueueAfter(controlPlane.Namespace, controlPlane.Name, drainPollInterval)
+	return false, nil
+}
+
+func (p *Planner) podsToEvict(client kubernetes.Interface, node *corev1.Node, opts rkev1.DrainOptions) (result []corev1.Pod, _ error) {
+	pods, err := client.CoreV1().Pods("").List(p.ctx, metav1.ListOptions{
+		FieldSelector: fields.SelectorFromSet(fields.Set{"spec.nodeName": node.Name}).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pod := range pods.Items {
+		if _, ok := pod.Annotations[mirrorPodAnnotation]; ok {
+			continue
+		}
+
+		controller := metav1.GetControllerOf(&pod)
+		if controller != nil && controller.Kind == "DaemonSet" {
+			// the options are defaulted by setDefaults
+			if opts.IgnoreDaemonSets != nil && *opts.IgnoreDaemonSets {
+				continue
+			}
+			return nil, fmt.Errorf("cannot drain node %s: pod %s/%s is managed by a DaemonSet", node.Name, pod.Namespace, pod.Name)
+		}
+
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			result = append(result, pod)
+			continue
+		}
+
+		if controller == nil && !opts.Force {
+			return nil, fmt.Errorf("cannot drain node %s: pod %s/%s is not managed by a controller", node.Name, pod.Namespace, pod.Name)
+		}
+
+		if !opts.DeleteEmptyDirData {
+			for _, volume := range pod.Spec.Volumes {
+				if volume.EmptyDir != nil {
+					return nil, fmt.Errorf("cannot drain node %s: pod %s/%s uses emptyDir volume %s", node.Name, pod.Namespace, pod.Name, volume.Name)
+				}
+			}
+		}
+
+		result = append(result, pod)
+	}
+
+	return result, nil
+}
+
+// uncordon marks the node of a machine schedulable again once it has applied its plan after being drained.
+func (p *Planner) uncordon(controlPlane *rkev1.RKEControlPlane, machine *capi.Machine) error {
+	if machine.Annotations[DrainStartedAnnotation] == "" && machine.Annotations[DrainDoneAnnotation] == "" {
+		return nil
+	}
+
+	client, err := p.downstreamClient(controlPlane)
+	if err != nil {
+		return err
+	}
+
+	node, err := p.getNode(client, machine)
+	if err != nil {
+		return err
+	}
+
+	if node != nil {
+		if err := p.setUnschedulable(client, node, false); err != nil {
+			return err
+		}
+	}
+
+	_, err = p.updateMachineAnnotations(machine, nil, DrainStartedAnnotation, DrainDoneAnnotation)
+	return err
+}
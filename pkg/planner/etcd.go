@@ -0,0 +1,220 @@
+package planner
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/rancher/wrangler/pkg/condition"
+	apierror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	etcdSnapshotInstructionName = "etcd-snapshot"
+	etcdSnapshotConfigMapName   = "%s-etcd-snapshots"
+	etcdS3CAFileName            = "/var/lib/rancher/%s/etcd-s3-ca.crt"
+	// environment file of the systemd service of the runtime
+	etcdS3EnvFileName = "/etc/default/%s"
+
+	// ETCDSnapshotCreated reports the outcome of the last requested on-demand snapshot
+	ETCDSnapshotCreated = condition.Cond("ETCDSnapshotCreated")
+)
+
+// addETCDSnapshotConfig adds the snapshot schedule and S3 target to the config of an etcd node.
+func (p *Planner) addETCDSnapshotConfig(controlPlane *rkev1.RKEControlPlane, config map[string]interface{}, nodePlan *plan.NodePlan) error {
+	etcd := controlPlane.Spec.ETCD
+	if etcd == nil {
+		return nil
+	}
+
+	if etcd.DisableSnapshots {
+		config["etcd-disable-snapshots"] = true
+	}
+	if etcd.SnapshotScheduleCron != "" {
+		config["etcd-snapshot-schedule-cron"] = etcd.SnapshotScheduleCron
+	}
+	if etcd.SnapshotRetention > 0 {
+		config["etcd-snapshot-retention"] = etcd.SnapshotRetention
+	}
+
+	s3 := etcd.S3
+	if s3 == nil {
+		return nil
+	}
+
+	config["etcd-s3"] = true
+	if s3.Endpoint != "" {
+		config["etcd-s3-endpoint"] = s3.Endpoint
+	}
+	if s3.SkipSSLVerify {
+		config["etcd-s3-skip-ssl-verify"] = true
+	}
+	if s3.Bucket != "" {
+		config["etcd-s3-bucket"] = s3.Bucket
+	}
+	if s3.Region != "" {
+		config["etcd-s3-region"] = s3.Region
+	}
+	if s3.Folder != "" {
+		config["etcd-s3-folder"] = s3.Folder
+	}
+
+	if s3.EndpointCA != "" {
+		caFile := fmt.Sprintf(etcdS3CAFileName, GetRuntime(controlPlane.Spec.KubernetesVersion))
+		nodePlan.Files = append(nodePlan.Files, plan.File{
+			Content: base64.StdEncoding.EncodeToString([]byte(s3.EndpointCA)),
+			Path:    caFile,
+		})
+		config["etcd-s3-endpoint-ca"] = caFile
+	}
+
+	credentials, err := p.etcdS3Credentials(controlPlane)
+	if err != nil || len(credentials) == 0 {
+		return err
+	}
+
+	// the service reads the credentials from its environment file, they are not written to the config
+	nodePlan.Files = append(nodePlan.Files, plan.File{
+		Content:     base64.StdEncoding.EncodeToString([]byte(strings.Join(credentials, "\n") + "\n")),
+		Path:        fmt.Sprintf(etcdS3EnvFileName, serviceName(GetRuntime(controlPlane.Spec.KubernetesVersion))),
+		Permissions: "0600",
+	})
+	return nil
+}
+
+// etcdS3Credentials returns the S3 credentials of the credential secret as the environment variables read by the
+// runtime.
+func (p *Planner) etcdS3Credentials(controlPlane *rkev1.RKEControlPlane) ([]string, error) {
+	etcd := controlPlane.Spec.ETCD
+	if etcd == nil || etcd.S3 == nil || etcd.S3.CredentialSecretName == "" {
+		return nil, nil
+	}
+
+	secret, err := p.secretCache.Get(controlPlane.Namespace, etcd.S3.CredentialSecretName)
+	if err != nil {
+		return nil, err
+	}
+	return []string{
+		"AWS_ACCESS_KEY_ID=" + string(secret.Data["accessKey"]),
+		"AWS_SECRET_ACCESS_KEY=" + string(secret.Data["secretKey"]),
+	}, nil
+}
+
+func etcdSnapshotCreateGeneration(controlPlane *rkev1.RKEControlPlane) int {
+	if controlPlane.Spec.ETCDSnapshotCreate == nil {
+		return 0
+	}
+	return controlPlane.Spec.ETCDSnapshotCreate.Generation
+}
+
+// etcdSnapshotCreatePending returns true while the requested on-demand snapshot has not been recorded as created.
+func etcdSnapshotCreatePending(controlPlane *rkev1.RKEControlPlane) bool {
+	generation := etcdSnapshotCreateGeneration(controlPlane)
+	return generation > 0 && generation != controlPlane.Status.ETCDSnapshotCreateGeneration
+}
+
+func (p *Planner) etcdSnapshotInstruction(controlPlane *rkev1.RKEControlPlane) (plan.Instruction, error) {
+	credentials, err := p.etcdS3Credentials(controlPlane)
+	if err != nil {
+		return plan.Instruction{}, err
+	}
+
+	generation := strconv.Itoa(etcdSnapshotCreateGeneration(controlPlane))
+	return plan.Instruction{
+		Name:    etcdSnapshotInstructionName + "-" + generation,
+		Command: GetRuntime(controlPlane.Spec.KubernetesVersion),
+		Args:    []string{"etcd-snapshot", "--name", "on-demand-" + generation},
+		Env:     credentials,
+	}, nil
+}
+
+// createETCDSnapshot takes the requested on-demand snapshot on the init node. The snapshot is taken by a one-shot
+// plan, so the plan of the init node doesn't change and the node isn't restarted. Failures are reported in the
+// ETCDSnapshotCreated condition and returned as errIgnore, the snapshot is retried after failureRetryInterval.
+func (p *Planner) createETCDSnapshot(controlPlane *rkev1.RKEControlPlane, status *rkev1.RKEControlPlaneStatus, clusterPlan *plan.Plan) error {
+	if usesExternalDatastore(controlPlane) || !etcdSnapshotCreatePending(controlPlane) {
+		return nil
+	}
+
+	entries, _ := collect(clusterPlan, isInitNode)
+	for _, entry := range entries {
+		// the init node is provisioned first, the snapshot is taken once it is up
+		if entry.Plan == nil || !entry.Plan.OneShot && !isHealthy(entry) {
+			continue
+		}
+
+		instruction, err := p.etcdSnapshotInstruction(controlPlane)
+		if err == nil {
+			err = p.runOneShot(entry, "etcd snapshot", instruction)
+		}
+
+		var errWaiting ErrWaiting
+		if errors.As(err, &errWaiting) {
+			return err
+		} else if err != nil {
+			ETCDSnapshotCreated.SetError(status, "", err)
+			p.controlPlanes.EnqueueAfter(controlPlane.Namespace, controlPlane.Name, failureRetryInterval)
+			return errIgnore(err.Error())
+		}
+
+		status.ETCDSnapshotCreateGeneration = etcdSnapshotCreateGeneration(controlPlane)
+		ETCDSnapshotCreated.SetError(status, "", nil)
+		ETCDSnapshotCreated.Message(status, "created etcd snapshot on-demand-"+strconv.Itoa(status.ETCDSnapshotCreateGeneration))
+		return nil
+	}
+	return nil
+}
+
+type etcdSnapshotFile struct {
+	Name      string          `json:"name,omitempty"`
+	Location  string          `json:"location,omitempty"`
+	NodeName  string          `json:"nodeName,omitempty"`
+	CreatedAt *metav1.Time    `json:"createdAt,omitempty"`
+	Size      int64           `json:"size,omitempty"`
+	S3        json.RawMessage `json:"s3,omitempty"`
+}
+
+// listETCDSnapshots reads the snapshot list that the runtime records in the downstream cluster.
+func (p *Planner) listETCDSnapshots(controlPlane *rkev1.RKEControlPlane) ([]rkev1.ETCDSnapshot, error) {
+	client, err := p.downstreamClient(controlPlane)
+	if err != nil {
+		return nil, err
+	}
+
+	configMap, err := client.CoreV1().ConfigMaps("kube-system").Get(p.ctx,
+		fmt.Sprintf(etcdSnapshotConfigMapName, GetRuntime(controlPlane.Spec.KubernetesVersion)), metav1.GetOptions{})
+	if apierror.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var result []rkev1.ETCDSnapshot
+	for _, data := range configMap.Data {
+		file := etcdSnapshotFile{}
+		if err := json.Unmarshal([]byte(data), &file); err != nil {
+			return nil, err
+		}
+		result = append(result, rkev1.ETCDSnapshot{
+			Name:      file.Name,
+			NodeName:  file.NodeName,
+			Location:  file.Location,
+			Size:      file.Size,
+			CreatedAt: file.CreatedAt,
+			S3:        len(file.S3) > 0 && string(file.S3) != "null",
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result, nil
+}
@@ -0,0 +1,212 @@
+package planner
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/rancher/wrangler/pkg/condition"
+	corev1 "k8s.io/api/core/v1"
+	apierror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+)
+
+const (
+	// ETCDRemovalHookAnnotation blocks the termination of etcd machines until their etcd member and node are removed
+	ETCDRemovalHookAnnotation = capi.PreTerminateDeleteHookAnnotationPrefix + "/rke-etcd-member-removal"
+
+	etcdRemoveInstructionName = "etcd-remove"
+
+	// ETCDMemberRemoved is false while the deletion of an etcd machine is blocked because its member can't be
+	// removed safely
+	ETCDMemberRemoved = condition.Cond("ETCDMemberRemoved")
+
+	etcdRemoveNodeNameEnv = "ETCD_MEMBER_NODE_NAME"
+
+	// etcdctl is not shipped with k3s, on rke2 it is run from the etcd static pod if it isn't installed on the host
+	etcdRemoveScript = `set -e
+BIN=/var/lib/rancher/%[1]s/bin
+TLS=/var/lib/rancher/%[1]s/server/tls/etcd
+if command -v etcdctl >/dev/null; then
+  ETCDCTL=etcdctl
+else
+  export CRI_CONFIG_FILE=/var/lib/rancher/%[1]s/agent/etc/crictl.yaml
+  ETCDCTL="$BIN/crictl exec $($BIN/crictl ps --label io.kubernetes.container.name=etcd --quiet) etcdctl"
+fi
+ETCDCTL="$ETCDCTL --endpoints=https://127.0.0.1:2379 --cacert=$TLS/server-ca.crt --cert=$TLS/server-client.crt --key=$TLS/server-client.key"
+# members are named after their node followed by a dash and a hex suffix, the node name is compared as a string
+for id in $($ETCDCTL member list | awk -F', ' '{
+  name = ENVIRON["ETCD_MEMBER_NODE_NAME"]
+  if (index($3, name "-") == 1 && substr($3, length(name) + 2) ~ /^[0-9a-f]+$/) print $1
+}'); do
+  $ETCDCTL member remove $id
+done
+`
+)
+
+// etcdRemoveInstruction removes the etcd member of the node. The instruction is named after the machine so that a
+// later machine with the same node name is removed again.
+func etcdRemoveInstruction(runtime string, machine *capi.Machine, nodeName string) plan.Instruction {
+	return plan.Instruction{
+		Name:    etcdRemoveInstructionName + "-" + string(machine.UID),
+		Command: "sh",
+		Args:    []string{"-c", fmt.Sprintf(etcdRemoveScript, runtime)},
+		Env:     []string{etcdRemoveNodeNameEnv + "=" + nodeName},
+	}
+}
+
+// etcdMemberNodeName returns the name of the node of the machine, which is the prefix of its etcd member name. If
+// the node is gone the name is taken from the node reference of the machine or the node name set in its plan.
+func etcdMemberNodeName(entry planEntry, node *corev1.Node, runtime string) string {
+	if node != nil {
+		return node.Name
+	}
+	if entry.Machine.Status.NodeRef != nil {
+		return entry.Machine.Status.NodeRef.Name
+	}
+	if entry.Plan == nil || entry.Plan.AppliedPlan == nil {
+		return ""
+	}
+
+	configFile := fmt.Sprintf("/etc/rancher/%s/config.yaml", runtime)
+	for _, file := range entry.Plan.AppliedPlan.Files {
+		if file.Path != configFile {
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(file.Content)
+		if err != nil {
+			return ""
+		}
+		config := map[string]interface{}{}
+		if err := json.Unmarshal(data, &config); err != nil {
+			return ""
+		}
+		nodeName, _ := config["node-name"].(string)
+		return nodeName
+	}
+	return ""
+}
+
+// removeETCDMembers adds the removal hook to etcd machines and, for etcd machines being deleted, removes their etcd
+// member using a surviving etcd member and deletes their node before releasing the hook. The member is removed by a
+// one-shot plan, so the plan of the surviving member doesn't change. Machines are handled one at a time and
+// ErrWaiting is returned until no machine is left to be processed. Machines whose member can't be removed are
+// reported in the ETCDMemberRemoved condition and keep their hook. When the whole cluster is deleted the hooks of
+// all machines are released at once.
+func (p *Planner) removeETCDMembers(controlPlane *rkev1.RKEControlPlane, status *rkev1.RKEControlPlaneStatus, clusterPlan *plan.Plan) error {
+	clusterDeleting := controlPlane.DeletionTimestamp != nil || (clusterPlan.Cluster != nil && clusterPlan.Cluster.DeletionTimestamp != nil)
+
+	entries, _ := collect(clusterPlan, isEtcd)
+	var deleting []planEntry
+	for _, entry := range entries {
+		_, hooked := entry.Machine.Annotations[ETCDRemovalHookAnnotation]
+		switch {
+		case clusterDeleting && hooked:
+			// the whole cluster is going away, there is nothing to clean up
+			if _, err := p.updateMachineAnnotations(entry.Machine, nil, ETCDRemovalHookAnnotation); err != nil {
+				return err
+			}
+		case entry.Machine.DeletionTimestamp == nil && !hooked && !clusterDeleting:
+			if _, err := p.updateMachineAnnotations(entry.Machine, map[string]string{
+				ETCDRemovalHookAnnotation: "rke-planner",
+			}); err != nil {
+				return err
+			}
+		case entry.Machine.DeletionTimestamp != nil && hooked:
+			deleting = append(deleting, entry)
+		}
+	}
+
+	if len(deleting) == 0 {
+		if ETCDMemberRemoved.GetStatus(status) != "" {
+			ETCDMemberRemoved.SetError(status, "", nil)
+		}
+		return nil
+	}
+
+	entry := deleting[0]
+	if !isETCDMember(entry) {
+		// the machine never joined etcd, there is nothing to clean up
+		_, err := p.updateMachineAnnotations(entry.Machine, nil, ETCDRemovalHookAnnotation)
+		return err
+	}
+
+	// a member already running a one-shot plan finishes it, otherwise prefer the init node over any healthy member
+	var remover *planEntry
+	for i, candidate := range entries {
+		if candidate.Machine.DeletionTimestamp != nil {
+			continue
+		}
+		if candidate.Plan != nil && candidate.Plan.OneShot {
+			remover = &entries[i]
+			break
+		}
+		if isHealthyETCDMember(candidate) && (remover == nil || isInitNode(candidate.Machine)) {
+			remover = &entries[i]
+		}
+	}
+
+	if remover == nil {
+		for _, candidate := range entries {
+			if candidate.Machine.DeletionTimestamp == nil && isETCDMember(candidate) {
+				return etcdMemberRemovalBlocked(status, "NoHealthyMember",
+					"waiting for a healthy etcd member to remove the etcd member of machine "+entry.Machine.Name)
+			}
+		}
+		return etcdMemberRemovalBlocked(status, "LastMember",
+			"refusing to remove the etcd member of machine "+entry.Machine.Name+", it is the last etcd member")
+	}
+
+	client, err := p.downstreamClient(controlPlane)
+	if err != nil {
+		return err
+	}
+
+	node, err := p.getNode(client, entry.Machine)
+	if err != nil {
+		return err
+	}
+
+	runtime := GetRuntime(controlPlane.Spec.KubernetesVersion)
+	nodeName := etcdMemberNodeName(entry, node, runtime)
+	if nodeName == "" {
+		return etcdMemberRemovalBlocked(status, "UnknownNode",
+			"can't remove the etcd member of machine "+entry.Machine.Name+", the name of its node is unknown")
+	}
+
+	ETCDMemberRemoved.Unknown(status)
+	ETCDMemberRemoved.Reason(status, "Removing")
+	ETCDMemberRemoved.Message(status, "removing the etcd member of machine "+entry.Machine.Name)
+
+	err = p.runOneShot(*remover, "etcd member removal", etcdRemoveInstruction(runtime, entry.Machine, nodeName))
+	var errWaiting ErrWaiting
+	if errors.As(err, &errWaiting) {
+		return err
+	} else if err != nil {
+		p.controlPlanes.EnqueueAfter(controlPlane.Namespace, controlPlane.Name, failureRetryInterval)
+		return etcdMemberRemovalBlocked(status, "RemovalFailed", err.Error())
+	}
+
+	err = client.CoreV1().Nodes().Delete(p.ctx, nodeName, metav1.DeleteOptions{})
+	if err != nil && !apierror.IsNotFound(err) {
+		return err
+	}
+
+	if _, err := p.updateMachineAnnotations(entry.Machine, nil, ETCDRemovalHookAnnotation); err != nil {
+		return err
+	}
+
+	return ErrWaiting("removed etcd member of machine " + entry.Machine.Name)
+}
+
+// etcdMemberRemovalBlocked reports the machine whose deletion is blocked in the ETCDMemberRemoved condition.
+func etcdMemberRemovalBlocked(status *rkev1.RKEControlPlaneStatus, reason, message string) error {
+	ETCDMemberRemoved.False(status)
+	ETCDMemberRemoved.Reason(status, reason)
+	ETCDMemberRemoved.Message(status, message)
+	return ErrWaiting(message)
+}
@@ -0,0 +1,58 @@
+package planner
+
+import (
+	"sort"
+
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+// withFileTombstones adds a deleted entry to the desired plan for every file that was written by the previous plan
+// but is no longer desired. The add-ons of removed manifests are deleted by the plan that introduces their tombstone,
+// see withAddonRemoval. Tombstones of a previous plan that was not applied yet are carried forward. Once applied the
+// files are gone, so their tombstones are only kept as long as the plan doesn't change otherwise.
+func withFileTombstones(previous *plan.Node, desired plan.NodePlan) plan.NodePlan {
+	result := addFileTombstones(previous.Plan, desired, !previous.InSync)
+	if !previous.InSync || equality.Semantic.DeepEqual(previous.Plan, result) {
+		return result
+	}
+
+	if unchanged := addFileTombstones(previous.Plan, desired, true); equality.Semantic.DeepEqual(previous.Plan, unchanged) {
+		return unchanged
+	}
+	return result
+}
+
+func addFileTombstones(previous plan.NodePlan, desired plan.NodePlan, carryTombstones bool) plan.NodePlan {
+	desiredPaths := map[string]bool{}
+	for _, file := range desired.Files {
+		desiredPaths[file.Path] = true
+	}
+
+	var tombstones []plan.File
+	for _, file := range previous.Files {
+		if file.Path == "" || desiredPaths[file.Path] || (file.Delete && !carryTombstones) {
+			continue
+		}
+		// manifests of the runtime are never removed, even if an add-on used to replace them
+		if isBundledManifestPath(file.Path) {
+			continue
+		}
+		desiredPaths[file.Path] = true
+		tombstones = append(tombstones, plan.File{
+			Path:   file.Path,
+			Delete: true,
+		})
+	}
+
+	if len(tombstones) == 0 {
+		return desired
+	}
+
+	sort.Slice(tombstones, func(i, j int) bool {
+		return tombstones[i].Path < tombstones[j].Path
+	})
+
+	desired.Files = append(desired.Files, tombstones...)
+	return withAddonRemoval(desired)
+}
@@ -0,0 +1,160 @@
+package planner
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	"k8s.io/apimachinery/pkg/api/equality"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+)
+
+// RollbackAnnotation on a machine, or on the control plane for all of its machines, reverts the plan to the most
+// recent plan that was applied and healthy. The machines keep that plan until the annotation is removed.
+const RollbackAnnotation = "rke.cattle.io/rollback"
+
+func rollbackRequested(controlPlane *rkev1.RKEControlPlane, machine *capi.Machine) bool {
+	return controlPlane.Annotations[RollbackAnnotation] != "" || machine.Annotations[RollbackAnnotation] != ""
+}
+
+// rollbackPlan returns the plan a node is rolled back to, which is the most recent plan of the node's history that
+// was applied and healthy. A node that already runs one of those plans keeps it, so the plan that was rolled back
+// from doesn't become the target of the rollback once it is recorded in the history.
+func rollbackPlan(node *plan.Node) (plan.NodePlan, bool) {
+	if node == nil {
+		return plan.NodePlan{}, false
+	}
+
+	var targets []plan.NodePlan
+	for _, record := range node.History {
+		if !record.Healthy {
+			continue
+		}
+		target := withoutOneShotSteps(record.Plan)
+		if len(target.Instructions) > 0 {
+			targets = append(targets, target)
+		}
+	}
+
+	current := withoutOneShotSteps(node.Plan)
+	for _, target := range targets {
+		if equality.Semantic.DeepEqual(target, current) {
+			return current, true
+		}
+	}
+
+	if len(targets) == 0 {
+		return plan.NodePlan{}, false
+	}
+	return targets[0], true
+}
+
+// withoutOneShotSteps removes the parts of a plan that must not run again when the plan is reapplied: the
+// instructions of operations such as etcd restores, token rotations, on-demand snapshots and etcd member removals,
+// and the tombstones of files that are already gone.
+func withoutOneShotSteps(nodePlan plan.NodePlan) plan.NodePlan {
+	var (
+		files        []plan.File
+		instructions []plan.Instruction
+	)
+	for _, file := range nodePlan.Files {
+		if !file.Delete {
+			files = append(files, file)
+		}
+	}
+	for _, instruction := range nodePlan.Instructions {
+		if !isOneShotInstruction(instruction) {
+			instructions = append(instructions, instruction)
+		}
+	}
+	nodePlan.Files = files
+	nodePlan.Instructions = instructions
+	return nodePlan
+}
+
+func isOneShotInstruction(instruction plan.Instruction) bool {
+	switch instruction.Name {
+	case stopServerInstructionName, etcdRestoreInstructionName, removeETCDDBInstructionName, removeAddonsInstructionName:
+		return true
+	}
+	return strings.HasPrefix(instruction.Name, tokenRotateInstructionName+"-") ||
+		strings.HasPrefix(instruction.Name, etcdSnapshotInstructionName+"-") ||
+		strings.HasPrefix(instruction.Name, etcdRemoveInstructionName+"-")
+}
+
+// planChangeSummary describes the differences between two plans by the files, instructions and probes that changed.
+func planChangeSummary(oldPlan, newPlan plan.NodePlan) string {
+	var changes []string
+	changes = appendChanges(changes, "files", changedKeys(fileDigests(oldPlan), fileDigests(newPlan)))
+	changes = appendChanges(changes, "instructions", changedKeys(instructionDigests(oldPlan), instructionDigests(newPlan)))
+	changes = appendChanges(changes, "probes", changedKeys(probeDigests(oldPlan), probeDigests(newPlan)))
+	if len(changes) == 0 {
+		return "no changes"
+	}
+	return strings.Join(changes, "; ")
+}
+
+func fileDigests(nodePlan plan.NodePlan) map[string]string {
+	result := map[string]string{}
+	for _, file := range nodePlan.Files {
+		result[file.Path] = digest(file)
+	}
+	return result
+}
+
+func instructionDigests(nodePlan plan.NodePlan) map[string]string {
+	result := map[string]string{}
+	for _, instruction := range nodePlan.Instructions {
+		name := instruction.Name
+		if name == "" {
+			name = instruction.Command
+		}
+		result[name] = digest(instruction)
+	}
+	return result
+}
+
+func probeDigests(nodePlan plan.NodePlan) map[string]string {
+	result := map[string]string{}
+	for name, probe := range nodePlan.Probes {
+		result[name] = digest(probe)
+	}
+	return result
+}
+
+func digest(obj interface{}) string {
+	data, _ := json.Marshal(obj)
+	return PlanHash(data)
+}
+
+func appendChanges(changes []string, kind string, changed map[string][]string) []string {
+	for _, change := range []string{"added", "changed", "removed"} {
+		if len(changed[change]) > 0 {
+			changes = append(changes, kind+" "+change+": "+strings.Join(changed[change], ", "))
+		}
+	}
+	return changes
+}
+
+// changedKeys compares the digests of two plans and returns the keys grouped by added, changed and removed.
+func changedKeys(oldDigests, newDigests map[string]string) map[string][]string {
+	result := map[string][]string{}
+	for key, newDigest := range newDigests {
+		if oldDigest, ok := oldDigests[key]; !ok {
+			result["added"] = append(result["added"], key)
+		} else if oldDigest != newDigest {
+			result["changed"] = append(result["changed"], key)
+		}
+	}
+	for key := range oldDigests {
+		if _, ok := newDigests[key]; !ok {
+			result["removed"] = append(result["removed"], key)
+		}
+	}
+	for _, keys := range result {
+		sort.Strings(keys)
+	}
+	return result
+}
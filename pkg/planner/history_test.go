@@ -0,0 +1,223 @@
+package planner
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+func installPlan(version string, files ...string) plan.NodePlan {
+	result := plan.NodePlan{
+		Instructions: []plan.Instruction{{Name: "install", Image: "installer:" + version}},
+	}
+	for _, file := range files {
+		result.Files = append(result.Files, plan.File{Path: file, Content: version})
+	}
+	return result
+}
+
+// applyPlan assigns the plan the way the store does and marks it as applied the way the agent does.
+func applyPlan(t *testing.T, secret *corev1.Secret, nodePlan plan.NodePlan) {
+	if err := recordPlanHistory(secret, nodePlan); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(nodePlan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret.Data["plan"] = data
+	secret.Data["appliedPlan"] = data
+}
+
+func secretNode(t *testing.T, secret *corev1.Secret) *plan.Node {
+	node, err := SecretToNode(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return node
+}
+
+// rollback runs a reconcile of a machine with the rollback annotation and returns the plan it would be assigned.
+func rollback(t *testing.T, secret *corev1.Secret) plan.NodePlan {
+	node := secretNode(t, secret)
+	target, ok := rollbackPlan(node)
+	if !ok {
+		target = node.Plan
+	}
+	return withFileTombstones(node, target)
+}
+
+func TestRollbackPlanIsPinned(t *testing.T) {
+	a := installPlan("a", "/etc/config.yaml")
+	b := installPlan("b", "/etc/config.yaml", "/etc/extra.yaml")
+
+	secret := &corev1.Secret{Data: map[string][]byte{}}
+	applyPlan(t, secret, a)
+	applyPlan(t, secret, b)
+
+	for i := 0; i < 3; i++ {
+		nodePlan := rollback(t, secret)
+		if !equality.Semantic.DeepEqual(withoutOneShotSteps(nodePlan), a) {
+			t.Fatalf("reconcile %d rolled back to %+v, expected %+v", i, nodePlan, a)
+		}
+		applyPlan(t, secret, nodePlan)
+	}
+}
+
+func TestRecordPlanHistory(t *testing.T) {
+	large := strings.Repeat("x", 200*1024)
+
+	tests := []struct {
+		name     string
+		plans    []plan.NodePlan
+		expected int
+	}{
+		{
+			name:     "kept up to the maximum",
+			plans:    []plan.NodePlan{installPlan("a"), installPlan("b"), installPlan("c"), installPlan("d"), installPlan("e"), installPlan("f"), installPlan("g")},
+			expected: maxPlanHistory,
+		},
+		{
+			name:     "cut by size",
+			plans:    []plan.NodePlan{installPlan(large + "a"), installPlan(large + "b"), installPlan(large + "c"), installPlan(large + "d")},
+			expected: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			secret := &corev1.Secret{Data: map[string][]byte{}}
+			for _, nodePlan := range test.plans {
+				applyPlan(t, secret, nodePlan)
+			}
+
+			size := 0
+			for _, value := range secret.Data {
+				size += len(value)
+			}
+			if size > maxPlanSecretSize {
+				t.Errorf("plan secret has %d bytes, expected at most %d", size, maxPlanSecretSize)
+			}
+			if history := secretNode(t, secret).History; len(history) != test.expected {
+				t.Errorf("history has %d plans, expected %d", len(history), test.expected)
+			}
+		})
+	}
+}
+
+func TestRollbackPlan(t *testing.T) {
+	a := installPlan("a")
+	b := installPlan("b")
+
+	rejoin := installPlan("b")
+	rejoin.Instructions = append([]plan.Instruction{removeETCDDBInstruction(RuntimeRKE2)}, rejoin.Instructions...)
+
+	tests := []struct {
+		name     string
+		node     *plan.Node
+		expected plan.NodePlan
+		ok       bool
+	}{
+		{
+			name: "no history",
+			node: &plan.Node{Plan: b},
+		},
+		{
+			name: "only unhealthy plans",
+			node: &plan.Node{
+				Plan:    b,
+				History: []plan.PlanRecord{{Plan: a}},
+			},
+		},
+		{
+			name: "most recent healthy plan",
+			node: &plan.Node{
+				Plan: installPlan("c"),
+				History: []plan.PlanRecord{
+					{Plan: installPlan("d")},
+					{Plan: b, Healthy: true},
+					{Plan: a, Healthy: true},
+				},
+			},
+			expected: b,
+			ok:       true,
+		},
+		{
+			name: "current plan is a healthy plan",
+			node: &plan.Node{
+				Plan: a,
+				History: []plan.PlanRecord{
+					{Plan: b, Healthy: true},
+					{Plan: a, Healthy: true},
+				},
+			},
+			expected: a,
+			ok:       true,
+		},
+		{
+			name: "restore plans are not rerun",
+			node: &plan.Node{
+				Plan: installPlan("c"),
+				History: []plan.PlanRecord{
+					{Plan: plan.NodePlan{Instructions: []plan.Instruction{stopServerInstruction(RuntimeRKE2)}}, Healthy: true},
+					{Plan: rejoin, Healthy: true},
+				},
+			},
+			expected: b,
+			ok:       true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, ok := rollbackPlan(test.node)
+			if ok != test.ok {
+				t.Fatalf("rollbackPlan() returned %v, expected %v", ok, test.ok)
+			}
+			if !equality.Semantic.DeepEqual(actual, test.expected) {
+				t.Errorf("rollbackPlan() = %+v, expected %+v", actual, test.expected)
+			}
+		})
+	}
+}
+
+func TestPlanChangeSummary(t *testing.T) {
+	probe := plan.Probe{HTTPGetAction: plan.HTTPGetAction{URL: "http://127.0.0.1:10248/healthz"}}
+
+	tests := []struct {
+		name     string
+		old, new plan.NodePlan
+		expected string
+	}{
+		{
+			name:     "no changes",
+			old:      installPlan("a", "/a"),
+			new:      installPlan("a", "/a"),
+			expected: "no changes",
+		},
+		{
+			name:     "files",
+			old:      installPlan("a", "/a", "/b"),
+			new:      plan.NodePlan{Instructions: installPlan("a").Instructions, Files: []plan.File{{Path: "/b", Content: "b"}, {Path: "/c"}}},
+			expected: "files added: /c; files changed: /b; files removed: /a",
+		},
+		{
+			name:     "instructions and probes",
+			old:      installPlan("a"),
+			new:      plan.NodePlan{Instructions: installPlan("b").Instructions, Probes: map[string]plan.Probe{"kubelet": probe}},
+			expected: "instructions changed: install; probes added: kubelet",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := planChangeSummary(test.old, test.new); actual != test.expected {
+				t.Errorf("planChangeSummary() = %q, expected %q", actual, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package planner
+
+import (
+	"fmt"
+	"strings"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/settings"
+	"github.com/rancher/wrangler/pkg/condition"
+	apierror "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	InstallerImageResolved = condition.Cond("InstallerImageResolved")
+
+	defaultInstallerImagePrefix = "rancher/system-agent-installer-"
+)
+
+var (
+	// Releases known to have a system-agent-installer image, can be overridden by the
+	// rke2-versions and k3s-versions settings
+	defaultVersions = map[string][]string{
+		RuntimeRKE2: {
+			"v1.19.9+rke2r1",
+			"v1.20.4+rke2r1",
+			"v1.20.5+rke2r1",
+			"v1.20.6+rke2r1",
+			"v1.28.15+rke2r1",
+		},
+		RuntimeK3S: {
+			"v1.19.9+k3s1",
+			"v1.20.4+k3s1",
+			"v1.20.5+k3s1",
+			"v1.20.6+k3s1",
+			"v1.28.15+k3s1",
+		},
+	}
+)
+
+// getInstallerImage returns the installer image of the control plane. The image is derived from the version, versions
+// that are not known to have an installer image are only reported, see installerImageWarning.
+func (p *Planner) getInstallerImage(controlPlane *rkev1.RKEControlPlane) (string, error) {
+	if controlPlane.Spec.SystemAgentInstallerImage != "" {
+		return controlPlane.Spec.SystemAgentInstallerImage, nil
+	}
+
+	version := controlPlane.Spec.KubernetesVersion
+	if version == "" {
+		return "", fmt.Errorf("kubernetesVersion is not set")
+	}
+
+	prefix, err := settings.Get(p.settings, "system-agent-installer-image")
+	if apierror.IsNotFound(err) || (err == nil && prefix == "") {
+		prefix = defaultInstallerImagePrefix
+	} else if err != nil {
+		return "", err
+	}
+
+	image := prefix + GetRuntime(version) + ":" + strings.ReplaceAll(version, "+", "-")
+	return settings.PrefixPrivateRegistry(p.settings, image)
+}
+
+// installerImageWarning returns a warning if the installer image is derived for a version that is not known to have
+// an installer image.
+func (p *Planner) installerImageWarning(controlPlane *rkev1.RKEControlPlane) (string, error) {
+	if controlPlane.Spec.SystemAgentInstallerImage != "" {
+		return "", nil
+	}
+
+	version := controlPlane.Spec.KubernetesVersion
+	runtime := GetRuntime(version)
+	known, err := settings.GetList(p.settings, runtime+"-versions", defaultVersions[runtime])
+	if err != nil {
+		return "", err
+	}
+
+	for _, knownVersion := range known {
+		if knownVersion == version {
+			return "", nil
+		}
+	}
+	return fmt.Sprintf("unknown %s version %s, using the installer image derived from the version, known versions are %s",
+		runtime, version, strings.Join(known, ", ")), nil
+}
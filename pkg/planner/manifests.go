@@ -3,33 +3,223 @@ package planner
 import (
 	"encoding/base64"
 	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
 
 	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
 	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	manifestsDir = "/var/lib/rancher/%s/server/manifests"
+
+	clusterAgentManifest = "cluster-agent"
+
+	// removed manifests are deleted by the tombstones of the plan, the add-on created for them by the runtime is
+	// deleted afterwards so that the runtime removes the objects it deployed
+	removeAddonsInstructionName = "remove-addons"
+	removeAddonsScript          = `for i in $(seq 1 60); do
+  %s delete addons.k3s.cattle.io -n kube-system --ignore-not-found %s && exit 0
+  sleep 5
+done
+exit 1
+`
+)
+
+var (
+	// manifests deployed by the runtime itself, add-ons must not replace them
+	bundledManifests = map[string][]string{
+		RuntimeK3S: {"ccm", "coredns", "local-storage", "metrics-server", "rolebindings", "traefik"},
+		RuntimeRKE2: {"rke2-calico", "rke2-calico-crd", "rke2-canal", "rke2-cilium", "rke2-coredns", "rke2-ingress-nginx",
+			"rke2-kube-proxy", "rke2-metrics-server", "rke2-multus"},
+	}
+
+	addonNameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+	manifestsRegexp = regexp.MustCompile(`^/var/lib/rancher/([a-z0-9]+)/server/manifests/([^/]+)\.(yaml|yml|json)$`)
 )
 
 func (p *Planner) getControlPlaneManifests(controlPlane *rkev1.RKEControlPlane, runtime string) ([]plan.File, error) {
-	// NOTE: The agent does not have a means to delete files.  If you add a manifest that
-	// may not exist in the future then you should create an empty file to "delete" the file
+	// NOTE: Manifests that are no longer returned are removed from the node by the planner
+	// through file tombstones, see withFileTombstones
 
 	clusterAgent, err := p.getClusterAgent(controlPlane, runtime)
 	if err != nil {
 		return nil, err
 	}
 
-	return []plan.File{
+	addons, err := p.getAddonManifests(controlPlane, runtime)
+	if err != nil {
+		return nil, err
+	}
+
+	chartValues, err := getChartValues(controlPlane, runtime)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(append([]plan.File{
 		clusterAgent,
-	}, nil
+	}, addons...), chartValues...), nil
 }
 
 func (p *Planner) getClusterAgent(controlPlane *rkev1.RKEControlPlane, runtime string) (plan.File, error) {
-	data, err := p.loadClusterAgent(controlPlane)
+	data, err := p.clusterAgent(controlPlane)
 	if err != nil {
 		return plan.File{}, err
 	}
 
+	return manifestFile(runtime, clusterAgentManifest, data), nil
+}
+
+func manifestFile(runtime, name string, data []byte) plan.File {
 	return plan.File{
 		Content: base64.StdEncoding.EncodeToString(data),
-		Path:    fmt.Sprintf("/var/lib/rancher/%s/server/manifests/cluster-agent.yaml", runtime),
-	}, nil
+		Path:    path.Join(fmt.Sprintf(manifestsDir, runtime), name+".yaml"),
+	}
+}
+
+// bundledManifest returns true for the names of manifests that are deployed by the runtime itself.
+func bundledManifest(runtime, name string) bool {
+	for _, bundled := range bundledManifests[runtime] {
+		if name == bundled {
+			return true
+		}
+	}
+	return false
+}
+
+// isBundledManifestPath returns true for the paths of manifests that are deployed by the runtime itself.
+func isBundledManifestPath(file string) bool {
+	match := manifestsRegexp.FindStringSubmatch(file)
+	return match != nil && bundledManifest(match[1], match[2])
+}
+
+func chartConfigName(chart string) string {
+	return chart + "-config"
+}
+
+func (p *Planner) getAddonManifests(controlPlane *rkev1.RKEControlPlane, runtime string) (result []plan.File, _ error) {
+	chartConfigs := map[string]string{}
+	for chart := range controlPlane.Spec.ChartValues.Data {
+		chartConfigs[chartConfigName(chart)] = chart
+	}
+
+	names := map[string]bool{}
+	for _, addon := range controlPlane.Spec.AdditionalManifests {
+		if !addonNameRegexp.MatchString(addon.Name) {
+			return nil, fmt.Errorf("invalid add-on name %q, must be a lowercase RFC 1123 label", addon.Name)
+		}
+		if addon.Name == clusterAgentManifest || bundledManifest(runtime, addon.Name) {
+			return nil, fmt.Errorf("add-on name %q is reserved for a manifest deployed by %s", addon.Name, runtime)
+		}
+		if chart, ok := chartConfigs[addon.Name]; ok {
+			return nil, fmt.Errorf("add-on name %q is used for the values of chart %s", addon.Name, chart)
+		}
+		if names[addon.Name] {
+			return nil, fmt.Errorf("add-on name %q is used more than once", addon.Name)
+		}
+		names[addon.Name] = true
+
+		content := addon.Content
+		if content == "" && addon.ConfigMapName != "" {
+			configMap, err := p.configMapCache.Get(controlPlane.Namespace, addon.ConfigMapName)
+			if err != nil {
+				return nil, err
+			}
+			if addon.ConfigMapKey != "" {
+				content = configMap.Data[addon.ConfigMapKey]
+			} else {
+				var keys []string
+				for key := range configMap.Data {
+					keys = append(keys, key)
+				}
+				sort.Strings(keys)
+				for _, key := range keys {
+					content += "\n---\n" + configMap.Data[key]
+				}
+			}
+		}
+
+		result = append(result, manifestFile(runtime, addon.Name, []byte(content)))
+	}
+
+	return result, nil
+}
+
+func getChartValues(controlPlane *rkev1.RKEControlPlane, runtime string) (result []plan.File, _ error) {
+	var charts []string
+	for chart := range controlPlane.Spec.ChartValues.Data {
+		charts = append(charts, chart)
+	}
+	sort.Strings(charts)
+
+	for _, chart := range charts {
+		if !addonNameRegexp.MatchString(chart) {
+			return nil, fmt.Errorf("invalid chart name %q, must be a lowercase RFC 1123 label", chart)
+		}
+
+		values, err := yaml.Marshal(controlPlane.Spec.ChartValues.Data[chart])
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := yaml.Marshal(map[string]interface{}{
+			"apiVersion": "helm.cattle.io/v1",
+			"kind":       "HelmChartConfig",
+			"metadata": map[string]interface{}{
+				"name":      chart,
+				"namespace": "kube-system",
+			},
+			"spec": map[string]interface{}{
+				"valuesContent": string(values),
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, manifestFile(runtime, chartConfigName(chart), data))
+	}
+
+	return result, nil
+}
+
+// withAddonRemoval adds an instruction to the plan that deletes the add-ons of manifests that have a tombstone.
+func withAddonRemoval(nodePlan plan.NodePlan) plan.NodePlan {
+	var (
+		runtime string
+		addons  []string
+	)
+
+	for _, file := range nodePlan.Files {
+		if !file.Delete {
+			continue
+		}
+		match := manifestsRegexp.FindStringSubmatch(file.Path)
+		if match == nil {
+			continue
+		}
+		runtime = match[1]
+		addons = append(addons, match[2])
+	}
+
+	if len(addons) == 0 {
+		return nodePlan
+	}
+
+	kubectl := "k3s kubectl"
+	if runtime == RuntimeRKE2 {
+		kubectl = "/var/lib/rancher/rke2/bin/kubectl --kubeconfig /etc/rancher/rke2/rke2.yaml"
+	}
+
+	sort.Strings(addons)
+	nodePlan.Instructions = append(nodePlan.Instructions, plan.Instruction{
+		Name:    removeAddonsInstructionName,
+		Command: "sh",
+		Args:    []string{"-c", fmt.Sprintf(removeAddonsScript, kubectl, strings.Join(addons, " "))},
+	})
+	return nodePlan
 }
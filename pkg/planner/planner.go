@@ -8,25 +8,29 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 
 	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
 	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
 	"github.com/rancher/rancher-operator/pkg/clients"
 	capicontrollers "github.com/rancher/rancher-operator/pkg/generated/controllers/cluster.x-k8s.io/v1alpha4"
 	mgmtcontrollers "github.com/rancher/rancher-operator/pkg/generated/controllers/management.cattle.io/v3"
+	ranchercontrollers "github.com/rancher/rancher-operator/pkg/generated/controllers/rancher.cattle.io/v1"
+	rkecontrollers "github.com/rancher/rancher-operator/pkg/generated/controllers/rke.cattle.io/v1"
 	"github.com/rancher/rancher-operator/pkg/kubeconfig"
-	"github.com/rancher/rancher-operator/pkg/settings"
 	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	"github.com/rancher/wrangler/pkg/condition"
 	corecontrollers "github.com/rancher/wrangler/pkg/generated/controllers/core/v1"
 	"github.com/rancher/wrangler/pkg/name"
 	"github.com/rancher/wrangler/pkg/randomtoken"
 	"github.com/rancher/wrangler/pkg/summary"
+	"github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	apierror "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
 )
 
@@ -53,6 +57,8 @@ const (
 	SecretTypeMachinePlan = "rke.cattle.io/machine-plan"
 
 	authnWebhookFileName = "/var/lib/rancher/%s/kube-api-authn-webhook.yaml"
+
+	failureRetryInterval = 30 * time.Second
 )
 
 var (
@@ -83,6 +89,14 @@ func (e ErrWaiting) Error() string {
 	return string(e)
 }
 
+// ErrFailed is returned for failures that were recorded in the status and are retried, the status is persisted and
+// the failure is reported in the Provisioned condition.
+type ErrFailed string
+
+func (e ErrFailed) Error() string {
+	return string(e)
+}
+
 type errIgnore string
 
 func (e errIgnore) Error() string {
@@ -96,29 +110,38 @@ type Planner struct {
 	store                         *PlanStore
 	secretClient                  corecontrollers.SecretClient
 	secretCache                   corecontrollers.SecretCache
+	configMapCache                corecontrollers.ConfigMapCache
 	machines                      capicontrollers.MachineClient
 	clusterRegistrationTokenCache mgmtcontrollers.ClusterRegistrationTokenCache
 	settings                      mgmtcontrollers.SettingCache
 	capiClusters                  capicontrollers.ClusterCache
+	rancherClusterCache           ranchercontrollers.ClusterCache
+	controlPlanes                 rkecontrollers.RKEControlPlaneController
 	kubeconfig                    *kubeconfig.Manager
+	clusterAgent                  func(controlPlane *rkev1.RKEControlPlane) ([]byte, error)
 }
 
 func New(ctx context.Context, clients *clients.Clients) *Planner {
 	clients.Management.ClusterRegistrationToken().Cache().AddIndexer(clusterRegToken, func(obj *v3.ClusterRegistrationToken) ([]string, error) {
 		return []string{obj.Spec.ClusterName}, nil
 	})
-	return &Planner{
+	p := &Planner{
 		ctx: ctx,
 		store: NewStore(clients.Core.Secret(),
 			clients.CAPI.Machine().Cache()),
 		machines:                      clients.CAPI.Machine(),
 		secretClient:                  clients.Core.Secret(),
 		secretCache:                   clients.Core.Secret().Cache(),
+		configMapCache:                clients.Core.ConfigMap().Cache(),
 		clusterRegistrationTokenCache: clients.Management.ClusterRegistrationToken().Cache(),
 		settings:                      clients.Management.Setting().Cache(),
 		capiClusters:                  clients.CAPI.Cluster().Cache(),
+		rancherClusterCache:           clients.Cluster.Cluster().Cache(),
+		controlPlanes:                 clients.RKE.RKEControlPlane(),
 		kubeconfig:                    kubeconfig.New(clients),
 	}
+	p.clusterAgent = p.loadClusterAgent
+	return p
 }
 
 func PlanSecretFromBootstrapName(bootstrapName string) string {
@@ -138,62 +161,155 @@ func (p *Planner) getCAPICluster(controlPlane *rkev1.RKEControlPlane) (*capi.Clu
 	return p.capiClusters.Get(controlPlane.Namespace, ref.Name)
 }
 
-func (p *Planner) Process(controlPlane *rkev1.RKEControlPlane) error {
+func (p *Planner) Process(controlPlane *rkev1.RKEControlPlane) (rkev1.RKEControlPlaneStatus, error) {
+	status := controlPlane.Status
+
 	cluster, err := p.getCAPICluster(controlPlane)
 	if err != nil {
-		return err
+		return status, err
 	}
 
 	plan, err := p.store.Load(cluster)
 	if err != nil {
-		return err
+		return status, err
 	}
 
 	controlPlane, secret, err := p.generateSecrets(controlPlane)
 	if err != nil {
-		return err
+		return status, err
 	}
+	status = controlPlane.Status
+	setDefaults(controlPlane)
 
-	if _, err := p.electInitNode(plan); err != nil {
-		return err
+	if _, err := p.getInstallerImage(controlPlane); err != nil {
+		return status, p.reportFailure(controlPlane, &status, InstallerImageResolved, err)
+	}
+	// an unknown version only holds up the cluster if its installer image doesn't exist
+	warning, err := p.installerImageWarning(controlPlane)
+	if err != nil {
+		return status, p.reportFailure(controlPlane, &status, InstallerImageResolved, err)
+	}
+	InstallerImageResolved.SetError(&status, "", nil)
+	if warning != "" {
+		InstallerImageResolved.Reason(&status, "UnknownVersion")
+		InstallerImageResolved.Message(&status, warning)
 	}
 
-	var firstIgnoreError error
+	if err := validateDatastore(controlPlane, plan); err != nil {
+		return status, err
+	}
 
-	err = p.reconcile(controlPlane, secret, plan, "bootstrap", isInitNode, none, controlPlane.Spec.UpgradeStrategy.ServerConcurrency, "")
-	firstIgnoreError, err = ignoreErrors(firstIgnoreError, err)
+	etcdMembers, etcdHealthy := etcdQuorum(plan)
+	setETCDQuorumCondition(&status, etcdMembers, etcdHealthy)
+
+	joinServer, err := p.electInitNode(controlPlane, plan)
 	if err != nil {
-		return err
+		return status, err
 	}
 
-	joinServer, err := p.electInitNode(plan)
-	if err != nil || joinServer == "" {
-		return err
+	if etcdSnapshotRestoreRequested(controlPlane, status) {
+		return p.restoreETCDSnapshot(controlPlane, status, secret, plan, joinServer)
 	}
 
-	err = p.reconcile(controlPlane, secret, plan, "etcd", isEtcd, isInitNode, controlPlane.Spec.UpgradeStrategy.ServerConcurrency, joinServer)
-	firstIgnoreError, err = ignoreErrors(firstIgnoreError, err)
-	if err != nil {
-		return err
+	// tokens are only rotated once the cluster has been bootstrapped, a rejected rotation doesn't hold up the cluster
+	if joinServer != "" && tokenRotationRequested(controlPlane, status) {
+		if err := validateTokenRotation(controlPlane); err != nil {
+			TokensRotated.SetError(&status, "", err)
+		} else {
+			return p.rotateTokens(controlPlane, status, secret, plan, joinServer)
+		}
 	}
 
-	err = p.reconcile(controlPlane, secret, plan, "control plane", isControlPlane, isInitNode, controlPlane.Spec.UpgradeStrategy.ServerConcurrency, joinServer)
+	status.NextMaintenanceWindow = nil
+	if windowOpen, nextWindow, err := upgradeWindow(controlPlane.Spec.UpgradeStrategy, time.Now()); err != nil {
+		return status, err
+	} else if !windowOpen && !nextWindow.IsZero() {
+		status.NextMaintenanceWindow = &metav1.Time{Time: nextWindow}
+	}
+
+	if err := p.removeETCDMembers(controlPlane, &status, plan); err != nil {
+		return status, err
+	}
+
+	var firstIgnoreError error
+
+	// a failed snapshot is retried without holding up the rest of the cluster
+	err = p.createETCDSnapshot(controlPlane, &status, plan)
 	firstIgnoreError, err = ignoreErrors(firstIgnoreError, err)
 	if err != nil {
-		return err
+		return status, err
+	}
+
+	if usesExternalDatastore(controlPlane) {
+		// there is no etcd to bootstrap, all servers start against the datastore and don't join each other
+		err = p.reconcile(controlPlane, secret, plan, "control plane", isControlPlane, none, controlPlane.Spec.UpgradeStrategy.ServerConcurrency, "")
+		firstIgnoreError, err = ignoreErrors(firstIgnoreError, err)
+		if err != nil {
+			return status, err
+		}
+
+		joinServer, err = p.electInitNode(controlPlane, plan)
+		if err != nil {
+			return status, err
+		} else if joinServer == "" {
+			return status, ErrWaiting("waiting for a control plane node to join")
+		}
+	} else {
+		err = p.reconcile(controlPlane, secret, plan, "bootstrap", isInitNode, none, controlPlane.Spec.UpgradeStrategy.ServerConcurrency, "")
+		firstIgnoreError, err = ignoreErrors(firstIgnoreError, err)
+		if err != nil {
+			return status, err
+		}
+
+		joinServer, err = p.electInitNode(controlPlane, plan)
+		if err != nil || joinServer == "" {
+			return status, err
+		}
+
+		err = p.reconcile(controlPlane, secret, plan, "etcd", isEtcd, isInitNode, controlPlane.Spec.UpgradeStrategy.ServerConcurrency, joinServer)
+		firstIgnoreError, err = ignoreErrors(firstIgnoreError, err)
+		if err != nil {
+			return status, err
+		}
+
+		err = p.reconcile(controlPlane, secret, plan, "control plane", isControlPlane, isInitNode, controlPlane.Spec.UpgradeStrategy.ServerConcurrency, joinServer)
+		firstIgnoreError, err = ignoreErrors(firstIgnoreError, err)
+		if err != nil {
+			return status, err
+		}
 	}
 
 	err = p.reconcile(controlPlane, secret, plan, "worker", isOnlyWorker, isInitNode, controlPlane.Spec.UpgradeStrategy.WorkerConcurrency, joinServer)
 	firstIgnoreError, err = ignoreErrors(firstIgnoreError, err)
 	if err != nil {
-		return err
+		return status, err
 	}
 
 	if firstIgnoreError != nil {
-		return ErrWaiting(firstIgnoreError.Error())
+		return status, ErrWaiting(firstIgnoreError.Error())
 	}
 
-	return nil
+	if usesExternalDatastore(controlPlane) {
+		status.ETCDSnapshots = nil
+		return status, nil
+	}
+
+	// the snapshot list is informational, an unreachable downstream cluster keeps the last known list
+	if snapshots, err := p.listETCDSnapshots(controlPlane); err != nil {
+		logrus.Errorf("rkecluster %s/%s: failed to list etcd snapshots: %v", controlPlane.Namespace, controlPlane.Name, err)
+	} else {
+		status.ETCDSnapshots = snapshots
+	}
+	return status, nil
+}
+
+// reportFailure records err in the given condition of the status and returns it as ErrFailed, so that the status
+// handler persists the status instead of dropping it. The control plane is processed again after
+// failureRetryInterval.
+func (p *Planner) reportFailure(controlPlane *rkev1.RKEControlPlane, status *rkev1.RKEControlPlaneStatus, cond condition.Cond, err error) error {
+	cond.SetError(status, "", err)
+	p.controlPlanes.EnqueueAfter(controlPlane.Namespace, controlPlane.Name, failureRetryInterval)
+	return ErrFailed(err.Error())
 }
 
 func ignoreErrors(firstIgnoreError error, err error) (error, error) {
@@ -229,33 +345,60 @@ func (p *Planner) setInitNodeMark(machine *capi.Machine) (*capi.Machine, error)
 	return p.machines.Update(machine)
 }
 
-func (p *Planner) electInitNode(plan *plan.Plan) (string, error) {
-	entries, _ := collect(plan, isEtcd)
-	joinURL := ""
+// electInitNode returns the join URL of the init node. An init node that is being deleted or has failed is replaced
+// by a healthy etcd member if there is one. Otherwise the first etcd machine is elected while bootstrapping. Clusters
+// using an external datastore elect the init node from the control plane machines. Machines marked for deletion are
+// not elected and an init node marked for deletion is replaced while it can still be.
+func (p *Planner) electInitNode(controlPlane *rkev1.RKEControlPlane, plan *plan.Plan) (string, error) {
+	entries, _ := collect(plan, initNodeRole(controlPlane))
+	now := time.Now()
+
+	var candidate *capi.Machine
+	for _, entry := range entries {
+		if isHealthy(entry) && entry.Machine.Annotations[JoinURLAnnotation] != "" && !markedForDeletion(entry.Machine) {
+			candidate = entry.Machine
+			break
+		}
+	}
+
+	var (
+		found   bool
+		joinURL string
+	)
 	for _, entry := range entries {
 		if !isInitNode(entry.Machine) {
 			continue
 		}
 
-		// Clear old or misconfigured init nodes
-		if entry.Machine.DeletionTimestamp != nil || joinURL != "" {
+		// Clear old, misconfigured or failed init nodes
+		if entry.Machine.DeletionTimestamp != nil || found || (candidate != nil && (initNodeFailed(entry, now) || markedForDeletion(entry.Machine))) {
 			if err := p.clearInitNodeMark(entry.Machine); err != nil {
 				return "", err
 			}
 			continue
 		}
 
+		found = true
 		joinURL = entry.Machine.Annotations[JoinURLAnnotation]
 	}
 
-	if joinURL != "" {
+	if found {
 		return joinURL, nil
 	}
 
-	if len(entries) == 0 {
+	if candidate == nil {
+		for _, entry := range entries {
+			if entry.Machine.DeletionTimestamp == nil && !summary.Summarize(entry.Machine).Error &&
+				(candidate == nil || markedForDeletion(candidate)) {
+				candidate = entry.Machine
+			}
+		}
+	}
+
+	if candidate == nil {
 		return "", nil
 	}
-	machine, err := p.setInitNodeMark(entries[0].Machine)
+	machine, err := p.setInitNodeMark(candidate)
 	if err != nil {
 		return "", err
 	}
@@ -264,12 +407,27 @@ func (p *Planner) electInitNode(plan *plan.Plan) (string, error) {
 
 func (p *Planner) reconcile(controlPlane *rkev1.RKEControlPlane, secret plan.Secret, plan *plan.Plan,
 	tierName string,
-	include, exclude roleFilter, concurrency int, joinServer string) error {
+	include, exclude roleFilter, maxConcurrency *intstr.IntOrString, joinServer string) error {
 	entries, unavailable := collect(plan, include)
 
+	concurrency, err := resolveConcurrency(maxConcurrency, len(entries))
+	if err != nil {
+		return err
+	}
+
+	windowOpen, nextWindow, err := upgradeWindow(controlPlane.Spec.UpgradeStrategy, time.Now())
+	if err != nil {
+		return err
+	}
+
+	etcdMembers, etcdHealthy := etcdQuorum(plan)
+
 	var (
 		outOfSync   []string
+		unhealthy   []string
 		nonReady    []string
+		pending     []string
+		noQuorum    []string
 		errMachines []string
 	)
 
@@ -279,6 +437,12 @@ func (p *Planner) reconcile(controlPlane *rkev1.RKEControlPlane, secret plan.Sec
 			continue
 		}
 
+		machine, err := p.recordEffectiveConfig(controlPlane, entry.Machine)
+		if err != nil {
+			return err
+		}
+		entry.Machine = machine
+
 		summary := summary.Summarize(entry.Machine)
 		if summary.Error {
 			errMachines = append(errMachines, entry.Machine.Name)
@@ -292,16 +456,51 @@ func (p *Planner) reconcile(controlPlane *rkev1.RKEControlPlane, secret plan.Sec
 			return err
 		}
 
+		if rollbackRequested(controlPlane, entry.Machine) {
+			if target, ok := rollbackPlan(entry.Plan); ok {
+				plan = target
+			} else if entry.Plan != nil {
+				// nothing known to be good to go back to, leave the machine at its current plan
+				plan = entry.Plan.Plan
+			}
+		}
+
+		if entry.Plan != nil {
+			plan = withFileTombstones(entry.Plan, plan)
+		}
+
 		if entry.Plan == nil {
 			outOfSync = append(outOfSync, entry.Machine.Name)
 			if err := p.store.UpdatePlan(entry.Machine, plan); err != nil {
 				return err
 			}
 		} else if !equality.Semantic.DeepEqual(entry.Plan.Plan, plan) {
+			draining := entry.Machine.Annotations[DrainStartedAnnotation] != ""
+			if entry.Plan.InSync && !draining && !windowOpen {
+				pending = append(pending, entry.Machine.Name)
+				continue
+			}
+			if !draining && isHealthyETCDMember(entry) {
+				if !etcdCanLoseMember(etcdMembers, etcdHealthy) {
+					noQuorum = append(noQuorum, entry.Machine.Name)
+					continue
+				}
+				// the member goes down while applying the plan
+				etcdHealthy--
+			}
 			outOfSync = append(outOfSync, entry.Machine.Name)
-			if !entry.Plan.InSync || concurrency == 0 || unavailable < concurrency {
+			if !entry.Plan.InSync || draining || concurrency == 0 || unavailable < concurrency {
 				if entry.Plan.InSync {
-					unavailable++
+					if !draining {
+						unavailable++
+					}
+					if shouldDrain(controlPlane, entry.Machine) {
+						if drained, err := p.drain(controlPlane, entry.Machine); err != nil {
+							return err
+						} else if !drained {
+							continue
+						}
+					}
 				}
 				if err := p.store.UpdatePlan(entry.Machine, plan); err != nil {
 					return err
@@ -309,6 +508,10 @@ func (p *Planner) reconcile(controlPlane *rkev1.RKEControlPlane, secret plan.Sec
 			}
 		} else if !entry.Plan.InSync {
 			outOfSync = append(outOfSync, entry.Machine.Name)
+		} else if !entry.Plan.Healthy {
+			unhealthy = append(unhealthy, entry.Machine.Name)
+		} else if err := p.uncordon(controlPlane, entry.Machine); err != nil {
+			return err
 		}
 	}
 
@@ -327,6 +530,25 @@ func (p *Planner) reconcile(controlPlane *rkev1.RKEControlPlane, secret plan.Sec
 		return ErrWaiting("provisioning " + tierName + " node(s) " + strings.Join(outOfSync, ","))
 	}
 
+	noQuorum = atMostThree(noQuorum)
+	if len(noQuorum) > 0 {
+		return ErrWaiting("waiting for etcd quorum to update " + tierName + " node(s) " + strings.Join(noQuorum, ","))
+	}
+
+	unhealthy = atMostThree(unhealthy)
+	if len(unhealthy) > 0 {
+		return ErrWaiting("waiting for probes of " + tierName + " node(s) " + strings.Join(unhealthy, ","))
+	}
+
+	pending = atMostThree(pending)
+	if len(pending) > 0 {
+		if !nextWindow.IsZero() {
+			p.controlPlanes.EnqueueAfter(controlPlane.Namespace, controlPlane.Name, time.Until(nextWindow))
+		}
+		// provisioning of the remaining tiers and new machines continues while upgrades are pending
+		return errIgnore(upgradePendingMessage(nextWindow) + " for " + tierName + " node(s) " + strings.Join(pending, ","))
+	}
+
 	nonReady = atMostThree(nonReady)
 	if len(nonReady) > 0 {
 		// we want these errors to get reported, but not block the process
@@ -336,6 +558,83 @@ func (p *Planner) reconcile(controlPlane *rkev1.RKEControlPlane, secret plan.Sec
 	return nil
 }
 
+// applyPlans assigns the plan returned by desired to every machine matching include that already has a plan.
+// It returns ErrWaiting until all of those machines have applied their plan. A concurrency of 0 means all machines
+// are updated at once.
+func (p *Planner) applyPlans(clusterPlan *plan.Plan, include roleFilter, concurrency int, operation, action string,
+	desired func(entry planEntry) (plan.NodePlan, error)) error {
+	entries, _ := collect(clusterPlan, include)
+
+	var (
+		outOfSync []string
+		updating  int
+	)
+
+	for _, entry := range entries {
+		if entry.Plan == nil || entry.Machine.DeletionTimestamp != nil {
+			continue
+		}
+
+		if summary := summary.Summarize(entry.Machine); summary.Error {
+			return fmt.Errorf("%s failed on machine %s: %s", operation, entry.Machine.Name, strings.Join(summary.Message, ", "))
+		}
+
+		nodePlan, err := desired(entry)
+		if err != nil {
+			return err
+		}
+		nodePlan = withFileTombstones(entry.Plan, nodePlan)
+
+		if !equality.Semantic.DeepEqual(entry.Plan.Plan, nodePlan) {
+			outOfSync = append(outOfSync, entry.Machine.Name)
+			if concurrency == 0 || updating < concurrency {
+				updating++
+				if err := p.store.UpdatePlan(entry.Machine, nodePlan); err != nil {
+					return err
+				}
+			}
+		} else if !entry.Plan.InSync {
+			outOfSync = append(outOfSync, entry.Machine.Name)
+			updating++
+		}
+	}
+
+	outOfSync = atMostThree(outOfSync)
+	if len(outOfSync) > 0 {
+		return ErrWaiting(operation + ": " + action + " node(s) " + strings.Join(outOfSync, ","))
+	}
+
+	return nil
+}
+
+// runOneShot runs the instruction on the machine of the entry without changing its plan, see PlanStore.RunOneShot.
+// It returns ErrWaiting until the instruction ran.
+func (p *Planner) runOneShot(entry planEntry, operation string, instruction plan.Instruction) error {
+	done, err := p.store.RunOneShot(entry.Machine, instruction)
+	if err != nil {
+		return fmt.Errorf("%s failed on machine %s: %w", operation, entry.Machine.Name, err)
+	} else if !done {
+		return ErrWaiting(operation + ": running " + instruction.Name + " on node " + entry.Machine.Name)
+	}
+	return nil
+}
+
+// resolveConcurrency returns how many of the given number of machines may be updated at once. Percentages are
+// rounded down, but never to less than one machine. A result of 0 means no limit.
+func resolveConcurrency(concurrency *intstr.IntOrString, machines int) (int, error) {
+	if concurrency == nil {
+		return 0, nil
+	}
+	result, err := intstr.GetScaledValueFromIntOrPercent(concurrency, machines, false)
+	if err != nil {
+		return 0, err
+	}
+	if result < 1 && concurrency.Type == intstr.String && machines > 0 {
+		return 1, nil
+	}
+	return result, nil
+}
+
 func atMostThree(names []string) []string {
 	if len(names) == 0 {
 		return names
@@ -349,19 +648,21 @@ func atMostThree(names []string) []string {
 
 func (p *Planner) desiredPlan(controlPlane *rkev1.RKEControlPlane, secret plan.Secret, entry planEntry, initNode bool, joinServer string) (result plan.NodePlan, _ error) {
 	agent := false
-	config := map[string]interface{}{}
-	for _, opts := range controlPlane.Spec.Config {
-		sel, err := metav1.LabelSelectorAsSelector(opts.MachineLabelSelector)
-		if err != nil {
-			return result, err
-		}
-		if sel.Matches(labels.Set(controlPlane.Labels)) {
-			config = opts.Config.DeepCopy().Data
-			break
-		}
+	config, err := machineConfig(controlPlane, entry.Machine)
+	if err != nil {
+		return result, err
 	}
 
-	if initNode {
+	if err := p.resolveConfigValues(controlPlane, config); err != nil {
+		return result, err
+	}
+
+	if usesExternalDatastore(controlPlane) {
+		// servers share their state through the datastore, only agents join a server
+		if !isServer(entry.Machine) {
+			config["server"] = joinServer
+		}
+	} else if initNode {
 		if GetRuntime(controlPlane.Spec.KubernetesVersion) == RuntimeK3S {
 			config["cluster-init"] = true
 		}
@@ -378,26 +679,37 @@ func (p *Planner) desiredPlan(controlPlane *rkev1.RKEControlPlane, secret plan.S
 		agent = true
 	}
 
+	if isEtcd(entry.Machine) {
+		if err := p.addETCDSnapshotConfig(controlPlane, config, &result); err != nil {
+			return result, err
+		}
+	}
+
+	if usesExternalDatastore(controlPlane) && isServer(entry.Machine) {
+		if err := p.addDatastoreConfig(controlPlane, config, &result); err != nil {
+			return result, err
+		}
+	}
+
+	if err := p.addRegistries(controlPlane, &result); err != nil {
+		return result, err
+	}
+
 	runtime := GetRuntime(controlPlane.Spec.KubernetesVersion)
 
 	if isControlPlane(entry.Machine) {
-		data, err := p.loadClusterAgent(controlPlane)
+		manifests, err := p.getControlPlaneManifests(controlPlane, runtime)
 		if err != nil {
 			return result, err
 		}
 
-		authFile := fmt.Sprintf(authnWebhookFileName, GetRuntime(controlPlane.Spec.KubernetesVersion))
-		result.Files = append(result.Files, []plan.File{
-			{
-				Content: base64.StdEncoding.EncodeToString(data),
-				Path:    fmt.Sprintf("/var/lib/rancher/%s/server/manifests/cluster-agent.yaml", GetRuntime(controlPlane.Spec.KubernetesVersion)),
-			},
-			{
-				Content: base64.StdEncoding.EncodeToString(AuthnWebhook),
-				Path:    authFile,
-			},
-		}...)
-		config["kube-apiserver-arg"] = fmt.Sprintf("authentication-token-webhook-config-file=%s", authFile)
+		authFile := fmt.Sprintf(authnWebhookFileName, runtime)
+		result.Files = append(result.Files, manifests...)
+		result.Files = append(result.Files, plan.File{
+			Content: base64.StdEncoding.EncodeToString(AuthnWebhook),
+			Path:    authFile,
+		})
+		appendConfigList(config, "kube-apiserver-arg", fmt.Sprintf("authentication-token-webhook-config-file=%s", authFile))
 	}
 
 	image, err := p.getInstallerImage(controlPlane)
@@ -422,20 +734,18 @@ func (p *Planner) desiredPlan(controlPlane *rkev1.RKEControlPlane, secret plan.S
 	}
 
 	var labels []string
-	if data := entry.Machine.Annotations[LabelsAnnotation]; data != "" {
-		labelMap := map[string]string{}
-		if err := json.Unmarshal([]byte(data), &labelMap); err != nil {
-			return result, err
-		}
-		for k, v := range labelMap {
-			labels = append(labels, fmt.Sprintf("%s=%s", k, v))
-		}
+	labelMap, err := nodeLabels(entry.Machine)
+	if err != nil {
+		return result, err
+	}
+	for k, v := range labelMap {
+		labels = append(labels, fmt.Sprintf("%s=%s", k, v))
 	}
 
 	labels = append(labels, MachineUIDLabel+"="+string(entry.Machine.UID))
 
 	sort.Strings(labels)
-	config["node-label"] = labels
+	appendConfigList(config, "node-label", labels...)
 
 	if data := entry.Machine.Annotations[TaintsAnnotation]; data != "" {
 		var (
@@ -450,10 +760,11 @@ func (p *Planner) desiredPlan(controlPlane *rkev1.RKEControlPlane, secret plan.S
 		}
 
 		sort.Strings(taintString)
-		config["node-taint"] = taintString
+		appendConfigList(config, "node-taint", taintString...)
 	}
 
 	result.Instructions = append(result.Instructions, instruction)
+	result.Probes = probes(runtime, entry.Machine)
 
 	configData, err := json.MarshalIndent(config, "", "  ")
 	if err != nil {
@@ -461,8 +772,9 @@ func (p *Planner) desiredPlan(controlPlane *rkev1.RKEControlPlane, secret plan.S
 	}
 
 	result.Files = append(result.Files, plan.File{
-		Content: base64.StdEncoding.EncodeToString(configData),
-		Path:    fmt.Sprintf("/etc/rancher/%s/config.yaml", GetRuntime(controlPlane.Spec.KubernetesVersion)),
+		Content:     base64.StdEncoding.EncodeToString(configData),
+		Path:        fmt.Sprintf("/etc/rancher/%s/config.yaml", GetRuntime(controlPlane.Spec.KubernetesVersion)),
+		Permissions: "0600",
 	})
 
 	return result, nil
@@ -475,19 +787,10 @@ func GetRuntime(kubernetesVersion string) string {
 	return RuntimeRKE2
 }
 
-func (p *Planner) getInstallerImage(controlPlane *rkev1.RKEControlPlane) (string, error) {
-	if true {
-		// The only working image right now
-		return "docker.io/oats87/system-agent-installer-rke2:v1.19.8-alpha1-rke2r2", nil
-	}
-
-	runtime := GetRuntime(controlPlane.Spec.KubernetesVersion)
-	image, err := settings.Get(p.settings, "system-agent-installer-image")
-	if err != nil {
-		return "", err
-	}
-	image = image + runtime + ":" + strings.ReplaceAll(controlPlane.Spec.KubernetesVersion, "+", "-")
-	return settings.PrefixPrivateRegistry(p.settings, image)
+// markedForDeletion returns true for machines that CAPI removes first when their MachineSet is scaled down.
+func markedForDeletion(machine *capi.Machine) bool {
+	_, ok := machine.Annotations[capi.DeleteMachineAnnotation]
+	return ok
 }
 
 func isEtcd(machine *capi.Machine) bool {
@@ -502,10 +805,18 @@ func none(machine *capi.Machine) bool {
 	return false
 }
 
+func all(machine *capi.Machine) bool {
+	return true
+}
+
 func isControlPlane(machine *capi.Machine) bool {
 	return machine.Labels[ControlPlaneRoleLabel] == "true"
 }
 
+func isServer(machine *capi.Machine) bool {
+	return isEtcd(machine) || isControlPlane(machine)
+}
+
 func isOnlyEtcd(machine *capi.Machine) bool {
 	return isEtcd(machine) && !isControlPlane(machine)
 }
@@ -524,16 +835,18 @@ func collect(plan *plan.Plan, include func(*capi.Machine) bool) (result []planEn
 		if !include(machine) {
 			continue
 		}
-		result = append(result, planEntry{
+		entry := planEntry{
 			Machine: machine,
 			Plan:    plan.Nodes[name],
-		})
+		}
+		// machines being drained are about to receive a new plan and already count against the concurrency
+		if entry.Plan != nil && !entry.Plan.Healthy || machine.Annotations[DrainStartedAnnotation] != "" {
+			unavailable++
+		}
+		result = append(result, entry)
 	}
 
 	sort.Slice(result, func(i, j int) bool {
-		if result[i].Plan != nil && !result[i].Plan.InSync {
-			unavailable++
-		}
 		return result[i].Machine.Name < result[j].Machine.Name
 	})
 
@@ -571,8 +884,8 @@ func (p *Planner) ensureRKEStateSecret(controlPlane *rkev1.RKEControlPlane) (str
 				Namespace: controlPlane.Namespace,
 			},
 			Data: map[string][]byte{
-				"serverToken": []byte(serverToken),
-				"agentToken":  []byte(agentToken),
+				serverTokenKey: []byte(serverToken),
+				agentTokenKey:  []byte(agentToken),
 			},
 			Type: "rke.cattle.io/cluster-state",
 		}
@@ -587,7 +900,7 @@ func (p *Planner) ensureRKEStateSecret(controlPlane *rkev1.RKEControlPlane) (str
 	}
 
 	return secret.Name, plan.Secret{
-		ServerToken: string(secret.Data["serverToken"]),
-		AgentToken:  string(secret.Data["agentToken"]),
+		ServerToken: string(secret.Data[serverTokenKey]),
+		AgentToken:  string(secret.Data[agentTokenKey]),
 	}, nil
 }
@@ -0,0 +1,79 @@
+package planner
+
+import (
+	"fmt"
+
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+)
+
+const (
+	serverCACert     = "/var/lib/rancher/%s/server/tls/server-ca.crt"
+	apiserverCert    = "/var/lib/rancher/%s/server/tls/client-kube-apiserver.crt"
+	apiserverCertKey = "/var/lib/rancher/%s/server/tls/client-kube-apiserver.key"
+)
+
+// probes returns the default health probes for a machine based on its roles.
+func probes(runtime string, machine *capi.Machine) map[string]plan.Probe {
+	result := map[string]plan.Probe{
+		"kubelet": {
+			HTTPGetAction: plan.HTTPGetAction{
+				URL: "http://127.0.0.1:10248/healthz",
+			},
+		},
+	}
+
+	if isEtcd(machine) {
+		result["etcd"] = plan.Probe{
+			HTTPGetAction: plan.HTTPGetAction{
+				URL: "http://127.0.0.1:2381/health",
+			},
+		}
+	}
+
+	if isControlPlane(machine) {
+		result["kube-apiserver"] = plan.Probe{
+			HTTPGetAction: plan.HTTPGetAction{
+				URL:        "https://127.0.0.1:6443/readyz",
+				CACert:     fmt.Sprintf(serverCACert, runtime),
+				ClientCert: fmt.Sprintf(apiserverCert, runtime),
+				ClientKey:  fmt.Sprintf(apiserverCertKey, runtime),
+			},
+		}
+	}
+
+	if isServer(machine) {
+		// k3s serves the supervisor on the apiserver port, rke2 uses a dedicated port
+		port := 9345
+		if runtime == RuntimeK3S {
+			port = 6443
+		}
+		result["supervisor"] = plan.Probe{
+			HTTPGetAction: plan.HTTPGetAction{
+				URL:    fmt.Sprintf("https://127.0.0.1:%d/ping", port),
+				CACert: fmt.Sprintf(serverCACert, runtime),
+			},
+		}
+	}
+
+	for name, probe := range result {
+		probe.InitialDelaySeconds = 1
+		probe.PeriodSeconds = 5
+		probe.TimeoutSeconds = 5
+		probe.SuccessThreshold = 1
+		probe.FailureThreshold = 2
+		result[name] = probe
+	}
+
+	return result
+}
+
+// unhealthyProbes returns the names of the probes of the plan that are not reported as healthy by the agent.
+func unhealthyProbes(node *plan.Node) (result []string) {
+	for name := range node.Plan.Probes {
+		if !node.ProbeStatus[name].Healthy {
+			result = append(result, name)
+		}
+	}
+	return atMostThree(result)
+}
@@ -0,0 +1,105 @@
+package planner
+
+import (
+	"fmt"
+	"time"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/rancher/wrangler/pkg/condition"
+	"github.com/rancher/wrangler/pkg/summary"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+)
+
+const (
+	ETCDQuorum = condition.Cond("ETCDQuorum")
+
+	initNodeFailureTimeout = 15 * time.Minute
+)
+
+// isETCDMember returns true for etcd machines that have applied a plan and therefore joined etcd.
+func isETCDMember(entry planEntry) bool {
+	return isEtcd(entry.Machine) && entry.Plan != nil && entry.Plan.AppliedPlan != nil
+}
+
+// isHealthyETCDMember returns true for etcd members that are in sync, pass their probes and are not about to be
+// taken down.
+func isHealthyETCDMember(entry planEntry) bool {
+	return isEtcd(entry.Machine) && isHealthy(entry)
+}
+
+// isHealthy returns true for machines that have applied a plan, are in sync, pass their probes and are not about
+// to be taken down. Machines whose agent doesn't report probes are healthy once in sync, see SecretToNode.
+func isHealthy(entry planEntry) bool {
+	return entry.Plan != nil &&
+		entry.Plan.AppliedPlan != nil &&
+		entry.Plan.InSync &&
+		entry.Plan.Healthy &&
+		entry.Machine.DeletionTimestamp == nil &&
+		entry.Machine.Annotations[DrainStartedAnnotation] == "" &&
+		!summary.Summarize(entry.Machine).Error
+}
+
+// etcdQuorum returns the number of etcd members and how many of them are healthy.
+func etcdQuorum(clusterPlan *plan.Plan) (members, healthy int) {
+	entries, _ := collect(clusterPlan, isEtcd)
+	for _, entry := range entries {
+		if isETCDMember(entry) {
+			members++
+		}
+		if isHealthyETCDMember(entry) {
+			healthy++
+		}
+	}
+	return
+}
+
+// etcdCanLoseMember returns true if one of the healthy members can be taken down without losing quorum. Clusters
+// with one or two members can't tolerate any failure, they can only be changed while every member is healthy.
+func etcdCanLoseMember(members, healthy int) bool {
+	quorum := members/2 + 1
+	if members == quorum {
+		return healthy == members
+	}
+	return healthy-1 >= quorum
+}
+
+func setETCDQuorumCondition(status *rkev1.RKEControlPlaneStatus, members, healthy int) {
+	if members == 0 {
+		ETCDQuorum.Unknown(status)
+		ETCDQuorum.Message(status, "no etcd members")
+		return
+	}
+
+	message := fmt.Sprintf("%d of %d etcd members healthy, quorum is %d", healthy, members, members/2+1)
+	if healthy < members/2+1 {
+		ETCDQuorum.False(status)
+		ETCDQuorum.Reason(status, "QuorumLost")
+	} else {
+		ETCDQuorum.True(status)
+		ETCDQuorum.Reason(status, "")
+	}
+	ETCDQuorum.Message(status, message)
+}
+
+// initNodeFailed returns true if the init node is in a state it is not expected to recover from by itself. That is
+// the case once CAPI reports a terminal failure of the machine or its plan has been failing for longer than
+// initNodeFailureTimeout. A plan that fails once, such as a failed snapshot, doesn't cause another node to be elected.
+func initNodeFailed(entry planEntry, now time.Time) bool {
+	status := entry.Machine.Status
+	if status.FailureReason != nil || status.FailureMessage != nil || status.GetTypedPhase() == capi.MachinePhaseFailed {
+		return true
+	}
+	if entry.Plan == nil || !entry.Plan.Failed {
+		return false
+	}
+
+	// the results belong to the failed plan, the earliest start is when the plan started failing
+	var failedSince time.Time
+	for _, result := range entry.Plan.Results {
+		if result.StartTime != nil && (failedSince.IsZero() || result.StartTime.Time.Before(failedSince)) {
+			failedSince = result.StartTime.Time
+		}
+	}
+	return !failedSince.IsZero() && now.Sub(failedSince) > initNodeFailureTimeout
+}
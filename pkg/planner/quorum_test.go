@@ -0,0 +1,198 @@
+package planner
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+)
+
+func TestETCDCanLoseMember(t *testing.T) {
+	tests := []struct {
+		members, healthy int
+		expected         bool
+	}{
+		{members: 0, healthy: 0, expected: false},
+		{members: 1, healthy: 1, expected: true},
+		{members: 1, healthy: 0, expected: false},
+		{members: 2, healthy: 2, expected: true},
+		{members: 2, healthy: 1, expected: false},
+		{members: 3, healthy: 3, expected: true},
+		{members: 3, healthy: 2, expected: false},
+		{members: 4, healthy: 4, expected: true},
+		{members: 4, healthy: 3, expected: false},
+		{members: 5, healthy: 5, expected: true},
+		{members: 5, healthy: 4, expected: true},
+		{members: 5, healthy: 3, expected: false},
+	}
+
+	for _, test := range tests {
+		if actual := etcdCanLoseMember(test.members, test.healthy); actual != test.expected {
+			t.Errorf("etcdCanLoseMember(%d, %d) = %v, expected %v", test.members, test.healthy, actual, test.expected)
+		}
+	}
+}
+
+func etcdMachine(name string, annotations map[string]string) *capi.Machine {
+	return &capi.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Labels:      map[string]string{EtcdRoleLabel: "true"},
+			Annotations: annotations,
+		},
+	}
+}
+
+func planSecret(t *testing.T, nodePlan plan.NodePlan, applied bool, probeStatus map[string]plan.ProbeStatus) *corev1.Secret {
+	data, err := json.Marshal(nodePlan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := &corev1.Secret{
+		Data: map[string][]byte{
+			"plan": data,
+		},
+	}
+	if applied {
+		secret.Data["appliedPlan"] = data
+	}
+	if probeStatus != nil {
+		data, err := json.Marshal(probeStatus)
+		if err != nil {
+			t.Fatal(err)
+		}
+		secret.Data[ProbeStatusKey] = data
+	}
+	return secret
+}
+
+func TestETCDQuorum(t *testing.T) {
+	nodePlan := plan.NodePlan{
+		Instructions: []plan.Instruction{{Name: "install"}},
+		Probes: map[string]plan.Probe{
+			"etcd": {},
+		},
+	}
+	healthy := map[string]plan.ProbeStatus{"etcd": {Healthy: true}}
+	unhealthy := map[string]plan.ProbeStatus{"etcd": {Healthy: false}}
+
+	tests := []struct {
+		name            string
+		annotations     map[string]string
+		applied         bool
+		probeStatus     map[string]plan.ProbeStatus
+		expectedMembers int
+		expectedHealthy int
+	}{
+		{
+			name:            "probes passing",
+			applied:         true,
+			probeStatus:     healthy,
+			expectedMembers: 1,
+			expectedHealthy: 1,
+		},
+		{
+			name:            "probes failing",
+			applied:         true,
+			probeStatus:     unhealthy,
+			expectedMembers: 1,
+			expectedHealthy: 0,
+		},
+		{
+			name:            "agent without probe support",
+			applied:         true,
+			expectedMembers: 1,
+			expectedHealthy: 1,
+		},
+		{
+			name:            "plan not applied",
+			applied:         false,
+			expectedMembers: 0,
+			expectedHealthy: 0,
+		},
+		{
+			name:            "draining",
+			annotations:     map[string]string{DrainStartedAnnotation: "true"},
+			applied:         true,
+			probeStatus:     healthy,
+			expectedMembers: 1,
+			expectedHealthy: 0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node, err := SecretToNode(planSecret(t, nodePlan, test.applied, test.probeStatus))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			clusterPlan := &plan.Plan{
+				Machines: map[string]*capi.Machine{"etcd-1": etcdMachine("etcd-1", test.annotations)},
+				Nodes:    map[string]*plan.Node{"etcd-1": node},
+			}
+
+			members, healthy := etcdQuorum(clusterPlan)
+			if members != test.expectedMembers || healthy != test.expectedHealthy {
+				t.Errorf("etcdQuorum() = %d, %d, expected %d, %d", members, healthy, test.expectedMembers, test.expectedHealthy)
+			}
+		})
+	}
+}
+
+func TestInitNodeFailed(t *testing.T) {
+	now := time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC)
+	failedPlan := func(started time.Duration) *plan.Node {
+		return &plan.Node{
+			Failed:  true,
+			Results: []plan.InstructionResult{{Name: "install", ExitCode: 1, StartTime: &metav1.Time{Time: now.Add(-started)}}},
+		}
+	}
+	failureMessage := "machine was deleted by the infrastructure provider"
+
+	tests := []struct {
+		name     string
+		status   capi.MachineStatus
+		node     *plan.Node
+		expected bool
+	}{
+		{
+			name: "plan applied",
+			node: &plan.Node{InSync: true},
+		},
+		{
+			name: "plan failed once",
+			node: failedPlan(time.Minute),
+		},
+		{
+			name:     "plan failing for longer than the timeout",
+			node:     failedPlan(initNodeFailureTimeout + time.Minute),
+			expected: true,
+		},
+		{
+			name:     "terminal machine failure",
+			status:   capi.MachineStatus{FailureMessage: &failureMessage},
+			node:     &plan.Node{InSync: true},
+			expected: true,
+		},
+		{
+			name:     "failed machine phase",
+			status:   capi.MachineStatus{Phase: string(capi.MachinePhaseFailed)},
+			expected: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			machine := etcdMachine("etcd-1", nil)
+			machine.Status = test.status
+			if actual := initNodeFailed(planEntry{Machine: machine, Plan: test.node}, now); actual != test.expected {
+				t.Errorf("initNodeFailed() = %v, expected %v", actual, test.expected)
+			}
+		})
+	}
+}
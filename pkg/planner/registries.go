@@ -0,0 +1,141 @@
+package planner
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	registriesFileName = "/etc/rancher/%s/registries.yaml"
+	registryTLSDir     = "/etc/rancher/%s/tls/registries/%s"
+)
+
+// registries mirrors the registries.yaml format understood by k3s and rke2
+type registries struct {
+	Mirrors map[string]registryMirror `json:"mirrors,omitempty"`
+	Configs map[string]registryConfig `json:"configs,omitempty"`
+}
+
+type registryMirror struct {
+	Endpoints []string          `json:"endpoint,omitempty"`
+	Rewrites  map[string]string `json:"rewrite,omitempty"`
+}
+
+type registryConfig struct {
+	Auth *registryAuth `json:"auth,omitempty"`
+	TLS  *registryTLS  `json:"tls,omitempty"`
+}
+
+type registryAuth struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+type registryTLS struct {
+	CAFile             string `json:"ca_file,omitempty"`
+	CertFile           string `json:"cert_file,omitempty"`
+	KeyFile            string `json:"key_file,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+}
+
+// addRegistries renders the registry configuration of the control plane into registries.yaml. Certificates from
+// the referenced TLS secrets are written as separate files next to it.
+func (p *Planner) addRegistries(controlPlane *rkev1.RKEControlPlane, nodePlan *plan.NodePlan) error {
+	if controlPlane.Spec.Registries == nil {
+		return nil
+	}
+
+	var (
+		runtime = GetRuntime(controlPlane.Spec.KubernetesVersion)
+		result  = registries{
+			Mirrors: map[string]registryMirror{},
+			Configs: map[string]registryConfig{},
+		}
+	)
+
+	for host, mirror := range controlPlane.Spec.Registries.Mirrors {
+		result.Mirrors[host] = registryMirror{
+			Endpoints: mirror.Endpoints,
+			Rewrites:  mirror.Rewrites,
+		}
+	}
+
+	// files are added in a stable order so the plan doesn't change between evaluations
+	var hosts []string
+	for host := range controlPlane.Spec.Registries.Configs {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	for _, host := range hosts {
+		config := controlPlane.Spec.Registries.Configs[host]
+		registryConfig := registryConfig{}
+
+		if config.AuthConfigSecretName != "" {
+			secret, err := p.secretCache.Get(controlPlane.Namespace, config.AuthConfigSecretName)
+			if err != nil {
+				return err
+			}
+			registryConfig.Auth = &registryAuth{
+				Username: string(secret.Data[corev1.BasicAuthUsernameKey]),
+				Password: string(secret.Data[corev1.BasicAuthPasswordKey]),
+			}
+		}
+
+		if config.TLSSecretName != "" || config.InsecureSkipVerify {
+			registryConfig.TLS = &registryTLS{
+				InsecureSkipVerify: config.InsecureSkipVerify,
+			}
+		}
+
+		if config.TLSSecretName != "" {
+			secret, err := p.secretCache.Get(controlPlane.Namespace, config.TLSSecretName)
+			if err != nil {
+				return err
+			}
+
+			// host names may contain a port which isn't a valid path element on every platform
+			dir := fmt.Sprintf(registryTLSDir, runtime, strings.ReplaceAll(host, ":", "_"))
+			for _, file := range []struct {
+				key    string
+				target *string
+			}{
+				{key: "ca.crt", target: &registryConfig.TLS.CAFile},
+				{key: corev1.TLSCertKey, target: &registryConfig.TLS.CertFile},
+				{key: corev1.TLSPrivateKeyKey, target: &registryConfig.TLS.KeyFile},
+			} {
+				if len(secret.Data[file.key]) == 0 {
+					continue
+				}
+				*file.target = dir + "/" + file.key
+				nodePlan.Files = append(nodePlan.Files, plan.File{
+					Content:     base64.StdEncoding.EncodeToString(secret.Data[file.key]),
+					Path:        *file.target,
+					Permissions: "0600",
+				})
+			}
+		}
+
+		result.Configs[host] = registryConfig
+	}
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	nodePlan.Files = append(nodePlan.Files, plan.File{
+		Content:     base64.StdEncoding.EncodeToString(data),
+		Path:        fmt.Sprintf(registriesFileName, runtime),
+		Permissions: "0600",
+	})
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package planner
+
+import (
+	"context"
+	"fmt"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	mgmtcontrollers "github.com/rancher/rancher-operator/pkg/generated/controllers/management.cattle.io/v3"
+	corecontrollers "github.com/rancher/wrangler/pkg/generated/controllers/core/v1"
+	"github.com/rancher/wrangler/pkg/name"
+	"github.com/rancher/wrangler/pkg/summary"
+	apierror "k8s.io/apimachinery/pkg/api/errors"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+)
+
+var (
+	renderedClusterAgent = []byte("# the cluster agent manifest is downloaded from rancher when the plan is applied\n")
+)
+
+// Render returns the plans, keyed by machine name, that would be assigned to the given machines of a control plane.
+// Secrets and settings are only read from the given caches and the cluster agent manifest is replaced by a
+// placeholder, so no API server is needed. The tokens of the cluster state secret are used if it exists.
+func Render(ctx context.Context, controlPlane *rkev1.RKEControlPlane, machines []*capi.Machine,
+	secrets corecontrollers.SecretCache, configMaps corecontrollers.ConfigMapCache, settings mgmtcontrollers.SettingCache) (map[string]plan.NodePlan, error) {
+	controlPlane = controlPlane.DeepCopy()
+	setDefaults(controlPlane)
+
+	p := &Planner{
+		ctx:            ctx,
+		secretCache:    secrets,
+		configMapCache: configMaps,
+		settings:       settings,
+		clusterAgent: func(*rkev1.RKEControlPlane) ([]byte, error) {
+			return renderedClusterAgent, nil
+		},
+	}
+
+	secret := plan.Secret{
+		ServerToken: "rendered-server-token",
+		AgentToken:  "rendered-agent-token",
+	}
+	state, err := secrets.Get(controlPlane.Namespace, name.SafeConcatName(controlPlane.Name, "rke", "state"))
+	if err == nil {
+		secret.ServerToken = string(state.Data[serverTokenKey])
+		secret.AgentToken = string(state.Data[agentTokenKey])
+	} else if !apierror.IsNotFound(err) {
+		return nil, err
+	}
+
+	clusterPlan := &plan.Plan{
+		Nodes:    map[string]*plan.Node{},
+		Machines: map[string]*capi.Machine{},
+	}
+	for _, machine := range machines {
+		clusterPlan.Machines[machine.Name] = machine
+	}
+
+	if err := validateDatastore(controlPlane, clusterPlan); err != nil {
+		return nil, err
+	}
+
+	initNode := renderInitNode(controlPlane, clusterPlan)
+	joinServer := ""
+	if initNode != nil {
+		joinServer = initNode.Annotations[JoinURLAnnotation]
+		if joinServer == "" {
+			port := 9345
+			if GetRuntime(controlPlane.Spec.KubernetesVersion) == RuntimeK3S {
+				port = 6443
+			}
+			joinServer = fmt.Sprintf("https://%s:%d", initNode.Name, port)
+		}
+	}
+
+	entries, _ := collect(clusterPlan, all)
+	result := map[string]plan.NodePlan{}
+	for _, entry := range entries {
+		nodePlan, err := p.desiredPlan(controlPlane, secret, entry, entry.Machine == initNode, joinServer)
+		if err != nil {
+			return nil, fmt.Errorf("rendering plan of machine %s: %w", entry.Machine.Name, err)
+		}
+		result[entry.Machine.Name] = nodePlan
+	}
+
+	return result, nil
+}
+
+// renderInitNode picks the init node the same way electInitNode would, without updating any machine.
+func renderInitNode(controlPlane *rkev1.RKEControlPlane, clusterPlan *plan.Plan) *capi.Machine {
+	entries, _ := collect(clusterPlan, initNodeRole(controlPlane))
+	for _, entry := range entries {
+		if isInitNode(entry.Machine) && entry.Machine.DeletionTimestamp == nil {
+			return entry.Machine
+		}
+	}
+	for _, entry := range entries {
+		if entry.Machine.DeletionTimestamp == nil && !summary.Summarize(entry.Machine).Error {
+			return entry.Machine
+		}
+	}
+	return nil
+}
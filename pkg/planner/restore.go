@@ -0,0 +1,183 @@
+package planner
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/rancher/wrangler/pkg/condition"
+)
+
+const (
+	ETCDRestorePhaseShutdown = "Shutdown"
+	ETCDRestorePhaseRestore  = "Restore"
+	ETCDRestorePhaseRejoin   = "Rejoin"
+	ETCDRestorePhaseCleanup  = "Cleanup"
+	ETCDRestorePhaseFinished = "Finished"
+
+	ETCDSnapshotRestored = condition.Cond("ETCDSnapshotRestored")
+
+	stopServerInstructionName   = "stop"
+	etcdRestoreInstructionName  = "etcd-restore"
+	removeETCDDBInstructionName = "remove-etcd-db"
+
+	etcdSnapshotDir = "/var/lib/rancher/%s/server/db/snapshots/%s"
+	etcdDBDir       = "/var/lib/rancher/%s/server/db"
+)
+
+func etcdSnapshotRestoreRequested(controlPlane *rkev1.RKEControlPlane, status rkev1.RKEControlPlaneStatus) bool {
+	restore := controlPlane.Spec.ETCDSnapshotRestore
+	return restore != nil && restore.Name != "" && restore.Generation != status.ETCDSnapshotRestoreGeneration
+}
+
+func serviceName(runtime string) string {
+	if runtime == RuntimeK3S {
+		return RuntimeK3S
+	}
+	return runtime + "-server"
+}
+
+func stopServerInstruction(runtime string) plan.Instruction {
+	return plan.Instruction{
+		Name:    stopServerInstructionName,
+		Command: "systemctl",
+		Args:    []string{"stop", serviceName(runtime)},
+	}
+}
+
+func removeETCDDBInstruction(runtime string) plan.Instruction {
+	return plan.Instruction{
+		Name:    removeETCDDBInstructionName,
+		Command: "rm",
+		Args:    []string{"-rf", fmt.Sprintf(etcdDBDir, runtime)},
+	}
+}
+
+// etcdRestorePath returns the value for --cluster-reset-restore-path. Snapshots stored in S3 are referenced by name
+// and downloaded by the runtime, local snapshots must be referenced by their full path on the init node.
+func etcdRestorePath(controlPlane *rkev1.RKEControlPlane, status rkev1.RKEControlPlaneStatus) string {
+	runtime := GetRuntime(controlPlane.Spec.KubernetesVersion)
+	snapshotName := controlPlane.Spec.ETCDSnapshotRestore.Name
+	for _, snapshot := range status.ETCDSnapshots {
+		if snapshot.Name != snapshotName {
+			continue
+		}
+		if snapshot.S3 {
+			return snapshotName
+		}
+		if strings.HasPrefix(snapshot.Location, "file://") {
+			return strings.TrimPrefix(snapshot.Location, "file://")
+		}
+	}
+	return fmt.Sprintf(etcdSnapshotDir, runtime, snapshotName)
+}
+
+// restoreETCDSnapshot moves the restore through its phases, the phase is recorded in the status after each of them.
+// Progress and failures are reported through the ETCDSnapshotRestored condition and, as ErrWaiting and ErrFailed, in
+// the Provisioned condition. Failures are retried in the phase they happened in.
+func (p *Planner) restoreETCDSnapshot(controlPlane *rkev1.RKEControlPlane, status rkev1.RKEControlPlaneStatus, secret plan.Secret,
+	clusterPlan *plan.Plan, joinServer string) (rkev1.RKEControlPlaneStatus, error) {
+	err := p.restoreETCDSnapshotPhase(controlPlane, &status, secret, clusterPlan, joinServer)
+
+	var errWaiting ErrWaiting
+	if errors.As(err, &errWaiting) {
+		if status.ETCDSnapshotRestorePhase != ETCDRestorePhaseFinished {
+			ETCDSnapshotRestored.Unknown(&status)
+			ETCDSnapshotRestored.Reason(&status, status.ETCDSnapshotRestorePhase)
+			ETCDSnapshotRestored.Message(&status, err.Error())
+		}
+		return status, err
+	} else if err != nil {
+		return status, p.reportFailure(controlPlane, &status, ETCDSnapshotRestored,
+			fmt.Errorf("etcd restore %s phase: %w", status.ETCDSnapshotRestorePhase, err))
+	}
+	return status, nil
+}
+
+func (p *Planner) restoreETCDSnapshotPhase(controlPlane *rkev1.RKEControlPlane, status *rkev1.RKEControlPlaneStatus, secret plan.Secret,
+	clusterPlan *plan.Plan, joinServer string) error {
+	runtime := GetRuntime(controlPlane.Spec.KubernetesVersion)
+	snapshotName := controlPlane.Spec.ETCDSnapshotRestore.Name
+
+	switch status.ETCDSnapshotRestorePhase {
+	case ETCDRestorePhaseShutdown:
+		// Stop every server so that nothing writes to etcd while the init node is being reset
+		err := p.applyPlans(clusterPlan, isServer, 0, "etcd restore", "stopping", func(entry planEntry) (plan.NodePlan, error) {
+			return plan.NodePlan{
+				Files:        entry.Plan.Plan.Files,
+				Instructions: []plan.Instruction{stopServerInstruction(runtime)},
+			}, nil
+		})
+		if err != nil {
+			return err
+		}
+		status.ETCDSnapshotRestorePhase = ETCDRestorePhaseRestore
+		return ErrWaiting("restoring etcd snapshot " + snapshotName)
+	case ETCDRestorePhaseRestore:
+		err := p.applyPlans(clusterPlan, isInitNode, 0, "etcd restore", "restoring etcd snapshot on", func(entry planEntry) (plan.NodePlan, error) {
+			return plan.NodePlan{
+				Files: entry.Plan.Plan.Files,
+				Instructions: []plan.Instruction{
+					stopServerInstruction(runtime),
+					{
+						Name:    etcdRestoreInstructionName,
+						Command: runtime,
+						Args: []string{
+							"server",
+							"--cluster-reset",
+							"--cluster-reset-restore-path=" + etcdRestorePath(controlPlane, *status),
+						},
+					},
+				},
+			}, nil
+		})
+		if err != nil {
+			return err
+		}
+		status.ETCDSnapshotRestorePhase = ETCDRestorePhaseRejoin
+		return ErrWaiting("rejoining server nodes after etcd restore")
+	case ETCDRestorePhaseRejoin:
+		// Start the init node with its regular plan first, then rejoin the other servers one at a time
+		err := p.applyPlans(clusterPlan, isInitNode, 0, "etcd restore", "starting", func(entry planEntry) (plan.NodePlan, error) {
+			return p.desiredPlan(controlPlane, secret, entry, true, joinServer)
+		})
+		if err != nil {
+			return err
+		}
+
+		err = p.applyPlans(clusterPlan, isServer, 1, "etcd restore", "rejoining", func(entry planEntry) (plan.NodePlan, error) {
+			nodePlan, err := p.desiredPlan(controlPlane, secret, entry, isInitNode(entry.Machine), joinServer)
+			if err != nil || isInitNode(entry.Machine) || !isEtcd(entry.Machine) {
+				return nodePlan, err
+			}
+			// the old etcd data must be removed so the member rejoins the restored cluster
+			nodePlan.Instructions = append([]plan.Instruction{removeETCDDBInstruction(runtime)}, nodePlan.Instructions...)
+			return nodePlan, nil
+		})
+		if err != nil {
+			return err
+		}
+
+		status.ETCDSnapshotRestorePhase = ETCDRestorePhaseCleanup
+		return ErrWaiting("replanning server nodes after etcd restore")
+	case ETCDRestorePhaseCleanup:
+		// Replace the rejoin plans so that the data of the members is not removed again when they rerun their plan
+		err := p.applyPlans(clusterPlan, isServer, 1, "etcd restore", "replanning", func(entry planEntry) (plan.NodePlan, error) {
+			return p.desiredPlan(controlPlane, secret, entry, isInitNode(entry.Machine), joinServer)
+		})
+		if err != nil {
+			return err
+		}
+
+		status.ETCDSnapshotRestorePhase = ETCDRestorePhaseFinished
+		status.ETCDSnapshotRestoreGeneration = controlPlane.Spec.ETCDSnapshotRestore.Generation
+		ETCDSnapshotRestored.SetError(status, "", nil)
+		ETCDSnapshotRestored.Message(status, "restored etcd snapshot "+snapshotName)
+		return ErrWaiting("etcd snapshot " + snapshotName + " restored")
+	default:
+		status.ETCDSnapshotRestorePhase = ETCDRestorePhaseShutdown
+		return ErrWaiting("stopping server nodes to restore etcd snapshot " + snapshotName)
+	}
+}
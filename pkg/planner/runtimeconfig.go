@@ -0,0 +1,155 @@
+package planner
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+var (
+	// keys of the config file are the flag names of the runtime
+	configKeyRegexp = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+	// keys set by the planner that must not be overridden by the user config
+	reservedConfigKeys = sets.NewString("token", "agent-token", "server", "cluster-init")
+
+	disableComponents = map[string]sets.String{
+		RuntimeRKE2: sets.NewString("rke2-canal", "rke2-coredns", "rke2-ingress-nginx", "rke2-kube-proxy", "rke2-metrics-server"),
+		RuntimeK3S:  sets.NewString("coredns", "servicelb", "traefik", "local-storage", "metrics-server"),
+	}
+	rke2CNIs        = sets.NewString("canal", "calico", "cilium", "none")
+	flannelBackends = sets.NewString("none", "vxlan", "ipsec", "host-gw", "wireguard")
+	rke2Profiles    = sets.NewString("cis-1.5", "cis-1.6")
+)
+
+// validateConfigKeys checks the free-form config of an RKESystemConfig entry.
+func validateConfigKeys(config map[string]interface{}) error {
+	for key := range config {
+		if !configKeyRegexp.MatchString(key) {
+			return fmt.Errorf("invalid config key %q, keys must be lowercase words separated by dashes", key)
+		}
+		if reservedConfigKeys.Has(key) {
+			return fmt.Errorf("config key %q is managed by the planner and can not be set", key)
+		}
+	}
+	return nil
+}
+
+// runtimeConfigData validates the typed config against the runtime and converts it to the keys of the config file.
+func runtimeConfigData(runtime string, runtimeConfig *rkev1.RuntimeConfig) (map[string]interface{}, error) {
+	result := map[string]interface{}{}
+	if runtimeConfig == nil {
+		return result, nil
+	}
+
+	for key, value := range map[string]string{
+		"cluster-cidr": runtimeConfig.ClusterCIDR,
+		"service-cidr": runtimeConfig.ServiceCIDR,
+	} {
+		if value == "" {
+			continue
+		}
+		for _, cidr := range strings.Split(value, ",") {
+			if _, _, err := net.ParseCIDR(strings.TrimSpace(cidr)); err != nil {
+				return nil, fmt.Errorf("invalid %s %q: %w", key, value, err)
+			}
+		}
+		result[key] = value
+	}
+
+	if runtimeConfig.ClusterDNS != "" {
+		if net.ParseIP(runtimeConfig.ClusterDNS) == nil {
+			return nil, fmt.Errorf("invalid cluster-dns %q, must be an IP address", runtimeConfig.ClusterDNS)
+		}
+		result["cluster-dns"] = runtimeConfig.ClusterDNS
+	}
+
+	if runtimeConfig.ClusterDomain != "" {
+		result["cluster-domain"] = runtimeConfig.ClusterDomain
+	}
+
+	if runtimeConfig.CNI != "" {
+		if runtime != RuntimeRKE2 {
+			return nil, fmt.Errorf("cni is only supported by %s, use flannelBackend for %s", RuntimeRKE2, runtime)
+		}
+		if !rke2CNIs.Has(runtimeConfig.CNI) {
+			return nil, fmt.Errorf("invalid cni %q, must be one of %v", runtimeConfig.CNI, rke2CNIs.List())
+		}
+		result["cni"] = runtimeConfig.CNI
+	}
+
+	if runtimeConfig.FlannelBackend != "" {
+		if runtime != RuntimeK3S {
+			return nil, fmt.Errorf("flannelBackend is only supported by %s, use cni for %s", RuntimeK3S, runtime)
+		}
+		if !flannelBackends.Has(runtimeConfig.FlannelBackend) {
+			return nil, fmt.Errorf("invalid flannelBackend %q, must be one of %v", runtimeConfig.FlannelBackend, flannelBackends.List())
+		}
+		result["flannel-backend"] = runtimeConfig.FlannelBackend
+	}
+
+	for _, component := range runtimeConfig.Disable {
+		if !disableComponents[runtime].Has(component) {
+			return nil, fmt.Errorf("invalid component %q to disable for %s, must be one of %v", component, runtime,
+				disableComponents[runtime].List())
+		}
+	}
+
+	if runtimeConfig.Profile != "" {
+		if runtime != RuntimeRKE2 {
+			return nil, fmt.Errorf("profile is only supported by %s", RuntimeRKE2)
+		}
+		if !rke2Profiles.Has(runtimeConfig.Profile) {
+			return nil, fmt.Errorf("invalid profile %q, must be one of %v", runtimeConfig.Profile, rke2Profiles.List())
+		}
+		result["profile"] = runtimeConfig.Profile
+	}
+
+	for key, values := range map[string][]string{
+		"disable":                     runtimeConfig.Disable,
+		"tls-san":                     runtimeConfig.TLSSAN,
+		"kube-apiserver-arg":          runtimeConfig.KubeAPIServerArg,
+		"kube-controller-manager-arg": runtimeConfig.KubeControllerManagerArg,
+		"kube-scheduler-arg":          runtimeConfig.KubeSchedulerArg,
+		"kubelet-arg":                 runtimeConfig.KubeletArg,
+		"kube-proxy-arg":              runtimeConfig.KubeProxyArg,
+		"etcd-arg":                    runtimeConfig.ETCDArg,
+	} {
+		if len(values) > 0 {
+			result[key] = append([]string(nil), values...)
+		}
+	}
+
+	for key, value := range map[string]bool{
+		"disable-kube-proxy":      runtimeConfig.DisableKubeProxy,
+		"etcd-expose-metrics":     runtimeConfig.ETCDExposeMetrics,
+		"selinux":                 runtimeConfig.SELinux,
+		"protect-kernel-defaults": runtimeConfig.ProtectKernelDefaults,
+	} {
+		if value {
+			result[key] = true
+		}
+	}
+
+	return result, nil
+}
+
+// appendConfigList appends values to a list key of the config, keeping the values set by the user.
+func appendConfigList(config map[string]interface{}, key string, values ...string) {
+	var result []string
+	switch existing := config[key].(type) {
+	case string:
+		result = append(result, existing)
+	case []string:
+		result = append(result, existing...)
+	case []interface{}:
+		for _, value := range existing {
+			result = append(result, fmt.Sprint(value))
+		}
+	}
+	config[key] = append(result, values...)
+}
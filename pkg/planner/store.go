@@ -2,13 +2,18 @@ package planner
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
 	capicontrollers "github.com/rancher/rancher-operator/pkg/generated/controllers/cluster.x-k8s.io/v1alpha4"
 	corecontrollers "github.com/rancher/wrangler/pkg/generated/controllers/core/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierror "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
@@ -22,7 +27,29 @@ const (
 	WaitingPlanStatusMessage            = "waiting for plan to be applied"
 	InSyncPlanStatus         PlanStatus = "InSync"
 	InSyncPlanStatusMessage             = "plan applied"
+	ProbesPlanStatus         PlanStatus = "WaitingForProbes"
+	ProbesPlanStatusMessage             = "waiting for probes: "
 	ErrorStatus              PlanStatus = "Error"
+
+	// The agent writes the results of the instructions it ran to ResultsKey and the checksum of the plan
+	// the results belong to to ResultsChecksumKey
+	ResultsKey         = "results"
+	ResultsChecksumKey = "results-checksum"
+	// The agent writes the status of the probes of the applied plan to ProbeStatusKey, agents that don't support
+	// probes never write the key
+	ProbeStatusKey = "probe-statuses"
+	// The previously applied plans of a machine are kept in PlanHistoryKey
+	PlanHistoryKey = "plan-history"
+	maxPlanHistory = 5
+	// The history is cut so that the plan secret, including the plan and the applied plan, stays well below the
+	// 1 MiB size limit of secrets
+	maxPlanSecretSize = 768 * 1024
+	// While a one-shot plan runs the plan it replaced is kept in OneShotPreviousPlanKey, the name of the last
+	// one-shot plan that ran is kept in OneShotCompletedKey, see PlanStore.RunOneShot
+	OneShotPreviousPlanKey = "one-shot-previous-plan"
+	OneShotCompletedKey    = "one-shot-completed"
+
+	maxOutputMessageLength = 1024
 )
 
 type PlanStatus string
@@ -97,6 +124,10 @@ func GetPlanStatusReasonMessage(plan *plan.Node) (corev1.ConditionStatus, PlanSt
 		return corev1.ConditionUnknown, NoPlanPlanStatus, NoPlanPlanStatusMessage
 	case plan.Plan.Error != "":
 		return corev1.ConditionFalse, ErrorStatus, plan.Plan.Error
+	case plan.Failed:
+		return corev1.ConditionFalse, ErrorStatus, FailedInstructionMessage(plan)
+	case plan.InSync && !plan.Healthy:
+		return corev1.ConditionUnknown, ProbesPlanStatus, ProbesPlanStatusMessage + strings.Join(unhealthyProbes(plan), ", ")
 	case plan.InSync:
 		return corev1.ConditionTrue, InSyncPlanStatus, InSyncPlanStatusMessage
 	default:
@@ -104,6 +135,33 @@ func GetPlanStatusReasonMessage(plan *plan.Node) (corev1.ConditionStatus, PlanSt
 	}
 }
 
+// FailedInstructionMessage describes the first failed instruction of the node, including the tail of its output.
+func FailedInstructionMessage(node *plan.Node) string {
+	for _, result := range node.Results {
+		if result.ExitCode == 0 {
+			continue
+		}
+		output := strings.TrimSpace(result.Stderr)
+		if output == "" {
+			output = strings.TrimSpace(result.Stdout)
+		}
+		if len(output) > maxOutputMessageLength {
+			output = "..." + output[len(output)-maxOutputMessageLength:]
+		}
+		msg := fmt.Sprintf("instruction %s failed with exit code %d", result.Name, result.ExitCode)
+		if output != "" {
+			msg += ": " + output
+		}
+		return msg
+	}
+	return ""
+}
+
+func PlanHash(plan []byte) string {
+	result := sha256.Sum256(plan)
+	return hex.EncodeToString(result[:])
+}
+
 func SecretToNode(secret *corev1.Secret) (*plan.Node, error) {
 	result := &plan.Node{}
 	planData := secret.Data["plan"]
@@ -125,7 +183,37 @@ func SecretToNode(secret *corev1.Secret) (*plan.Node, error) {
 		result.AppliedPlan = newPlan
 	}
 
+	if results := secret.Data[ResultsKey]; len(results) > 0 {
+		if err := json.Unmarshal(results, &result.Results); err != nil {
+			return nil, err
+		}
+	}
+
+	probeStatus, probesSupported := secret.Data[ProbeStatusKey]
+	if len(probeStatus) > 0 {
+		if err := json.Unmarshal(probeStatus, &result.ProbeStatus); err != nil {
+			return nil, err
+		}
+	}
+
+	if history := secret.Data[PlanHistoryKey]; len(history) > 0 {
+		if err := json.Unmarshal(history, &result.History); err != nil {
+			return nil, err
+		}
+	}
+
+	_, result.OneShot = secret.Data[OneShotPreviousPlanKey]
 	result.InSync = bytes.Equal(planData, appliedPlanData)
+	// without probe support a node is considered healthy once its plan is applied
+	result.Healthy = result.InSync && (!probesSupported || len(unhealthyProbes(result)) == 0)
+	if !result.InSync && string(secret.Data[ResultsChecksumKey]) == PlanHash(planData) {
+		for _, instructionResult := range result.Results {
+			if instructionResult.ExitCode != 0 {
+				result.Failed = true
+				break
+			}
+		}
+	}
 	return result, nil
 }
 
@@ -169,7 +257,149 @@ func (p *PlanStore) UpdatePlan(machine *capi.Machine, plan plan.NodePlan) error
 		secret.Data = map[string][]byte{}
 	}
 
+	if err := recordPlanHistory(secret, plan); err != nil {
+		return err
+	}
+
 	secret.Data["plan"] = data
+	// a new plan replaces a one-shot plan that didn't finish, the previous plan must not be restored over it
+	delete(secret.Data, OneShotPreviousPlanKey)
 	_, err = p.secrets.Update(secret)
 	return err
 }
+
+// RunOneShot runs the instruction on the machine without changing its plan. The instruction is assigned as a plan of
+// its own that keeps the probes of the current plan. Once the agent ran it the previous plan is assigned again
+// together with its applied checksum, so that the agent doesn't apply the previous plan again and the node isn't
+// restarted. It returns true once an instruction of the same name ran, which is not run again. A failed instruction
+// is returned as an error after the previous plan was restored. The one-shot plan is only assigned to machines that
+// applied their plan, a one-shot plan of another instruction is finished first.
+func (p *PlanStore) RunOneShot(machine *capi.Machine, instruction plan.Instruction) (bool, error) {
+	if !isRKEBootstrap(machine) {
+		return false, fmt.Errorf("machine %s/%s is not using RKEBootstrap", machine.Namespace, machine.Name)
+	}
+
+	secret, err := p.secrets.Get(machine.Namespace, PlanSecretFromBootstrapName(machine.Spec.Bootstrap.ConfigRef.Name), metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+
+	secret = secret.DeepCopy()
+	changed, done, runErr := runOneShot(secret, instruction)
+	if changed {
+		if _, err := p.secrets.Update(secret); err != nil {
+			return false, err
+		}
+	}
+	return done, runErr
+}
+
+// runOneShot moves the one-shot plan of the instruction in the plan secret to its next step. It returns whether the
+// secret was changed, whether the instruction ran and the error of a failed instruction.
+func runOneShot(secret *corev1.Secret, instruction plan.Instruction) (changed, done bool, _ error) {
+	if string(secret.Data[OneShotCompletedKey]) == instruction.Name {
+		return false, true, nil
+	}
+
+	node, err := SecretToNode(secret)
+	if err != nil || node == nil {
+		return false, false, err
+	}
+
+	previous, running := secret.Data[OneShotPreviousPlanKey]
+	if running {
+		if !node.InSync && !node.Failed {
+			return false, false, nil
+		}
+
+		// the one-shot plan that ran may belong to another instruction, it is finished on its behalf
+		var name string
+		if len(node.Plan.Instructions) > 0 {
+			name = node.Plan.Instructions[0].Name
+		}
+		secret.Data["plan"] = previous
+		secret.Data["appliedPlan"] = previous
+		secret.Data["applied-checksum"] = []byte(PlanHash(previous))
+		delete(secret.Data, OneShotPreviousPlanKey)
+		if node.Failed {
+			if name != instruction.Name {
+				return true, false, nil
+			}
+			return true, false, errors.New(FailedInstructionMessage(node))
+		}
+		secret.Data[OneShotCompletedKey] = []byte(name)
+		return true, name == instruction.Name, nil
+	}
+
+	if !node.InSync {
+		return false, false, nil
+	}
+	data, err := json.Marshal(plan.NodePlan{
+		Instructions: []plan.Instruction{instruction},
+		Probes:       node.Plan.Probes,
+	})
+	if err != nil {
+		return false, false, err
+	}
+	secret.Data[OneShotPreviousPlanKey] = secret.Data["plan"]
+	secret.Data["plan"] = data
+	return true, false, nil
+}
+
+// recordPlanHistory adds the plan of the secret to its history if it was applied and is about to be replaced by a
+// different plan. Only the last maxPlanHistory plans are kept, older plans are dropped earlier if the secret would
+// exceed maxPlanSecretSize.
+func recordPlanHistory(secret *corev1.Secret, newPlan plan.NodePlan) error {
+	node, err := SecretToNode(secret)
+	if err != nil || node == nil || !node.InSync || equality.Semantic.DeepEqual(node.Plan, newPlan) {
+		return err
+	}
+
+	newPlanData, err := json.Marshal(newPlan)
+	if err != nil {
+		return err
+	}
+
+	// the agent copies the new plan to the applied plan once it ran it
+	size := 2 * len(newPlanData)
+	for key, value := range secret.Data {
+		if key != "plan" && key != "appliedPlan" && key != PlanHistoryKey {
+			size += len(value)
+		}
+	}
+
+	records := []plan.PlanRecord{{
+		Plan:       node.Plan,
+		ReplacedAt: metav1.Now(),
+		Healthy:    node.Healthy,
+		Summary:    planChangeSummary(node.Plan, newPlan),
+	}}
+	for _, record := range node.History {
+		if !equality.Semantic.DeepEqual(record.Plan, node.Plan) {
+			records = append(records, record)
+		}
+	}
+
+	var history []plan.PlanRecord
+	for _, record := range records {
+		if len(history) >= maxPlanHistory {
+			break
+		}
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		// one byte for the separator of the record in the history
+		if size += len(data) + 1; size > maxPlanSecretSize {
+			break
+		}
+		history = append(history, record)
+	}
+
+	data, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+	secret.Data[PlanHistoryKey] = data
+	return nil
+}
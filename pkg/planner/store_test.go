@@ -0,0 +1,130 @@
+package planner
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// runAgent runs the plan of the secret the way the agent does if it wasn't applied yet and returns the number of
+// instructions it ran. A failing agent reports a non-zero exit code for every instruction.
+func runAgent(t *testing.T, secret *corev1.Secret, fail bool) int {
+	checksum := PlanHash(secret.Data["plan"])
+	if string(secret.Data["applied-checksum"]) == checksum {
+		return 0
+	}
+
+	node := secretNode(t, secret)
+	var results []plan.InstructionResult
+	for _, instruction := range node.Plan.Instructions {
+		result := plan.InstructionResult{Name: instruction.Name}
+		if fail {
+			result.ExitCode = 1
+		}
+		results = append(results, result)
+	}
+	data, err := json.Marshal(results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret.Data[ResultsKey] = data
+	secret.Data[ResultsChecksumKey] = []byte(checksum)
+	if !fail {
+		secret.Data["applied-checksum"] = []byte(checksum)
+		secret.Data["appliedPlan"] = secret.Data["plan"]
+	}
+	return len(results)
+}
+
+func TestRunOneShot(t *testing.T) {
+	snapshot := plan.Instruction{Name: "etcd-snapshot-1", Command: "rke2"}
+
+	tests := []struct {
+		name        string
+		fail        bool
+		expectedErr bool
+	}{
+		{
+			name: "instruction succeeds",
+		},
+		{
+			name:        "instruction fails",
+			fail:        true,
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			secret := &corev1.Secret{Data: map[string][]byte{}}
+			applyPlan(t, secret, installPlan("a", "/etc/config.yaml"))
+			secret.Data["applied-checksum"] = []byte(PlanHash(secret.Data["plan"]))
+			previous := secret.Data["plan"]
+
+			if _, done, err := runOneShot(secret, snapshot); done || err != nil {
+				t.Fatalf("runOneShot() assigning the plan returned %v, %v", done, err)
+			}
+			if node := secretNode(t, secret); !node.OneShot || len(node.Plan.Files) != 0 {
+				t.Fatalf("expected a one-shot plan without files, got %+v", node.Plan)
+			}
+			if ran := runAgent(t, secret, test.fail); ran != 1 {
+				t.Fatalf("agent ran %d instructions, expected 1", ran)
+			}
+
+			_, done, err := runOneShot(secret, snapshot)
+			if test.expectedErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+			} else if err != nil || !done {
+				t.Fatalf("runOneShot() returned %v, %v, expected the instruction to be done", done, err)
+			}
+
+			if !bytes.Equal(secret.Data["plan"], previous) || secretNode(t, secret).OneShot {
+				t.Fatalf("previous plan was not restored")
+			}
+			if ran := runAgent(t, secret, false); ran != 0 {
+				t.Errorf("agent reran the restored plan")
+			}
+
+			changed, done, err := runOneShot(secret, snapshot)
+			if test.expectedErr {
+				if !changed || done || err != nil {
+					t.Errorf("runOneShot() after a failure returned %v, %v, %v, expected a retry", changed, done, err)
+				}
+			} else if changed || !done || err != nil {
+				t.Errorf("runOneShot() after completion returned %v, %v, %v, expected no rerun", changed, done, err)
+			}
+		})
+	}
+}
+
+func TestRunOneShotFinishesOtherInstruction(t *testing.T) {
+	snapshot := plan.Instruction{Name: "etcd-snapshot-1", Command: "rke2"}
+	remove := plan.Instruction{Name: "etcd-remove-1234", Command: "sh"}
+
+	secret := &corev1.Secret{Data: map[string][]byte{}}
+	applyPlan(t, secret, installPlan("a"))
+	secret.Data["applied-checksum"] = []byte(PlanHash(secret.Data["plan"]))
+
+	if _, done, err := runOneShot(secret, snapshot); done || err != nil {
+		t.Fatalf("runOneShot() assigning the plan returned %v, %v", done, err)
+	}
+	runAgent(t, secret, false)
+
+	if changed, done, err := runOneShot(secret, remove); !changed || done || err != nil {
+		t.Fatalf("runOneShot() of another instruction returned %v, %v, %v, expected the snapshot to be finished", changed, done, err)
+	}
+	if changed, done, err := runOneShot(secret, snapshot); changed || !done || err != nil {
+		t.Errorf("runOneShot() of the finished snapshot returned %v, %v, %v, expected it to be done", changed, done, err)
+	}
+	if changed, done, err := runOneShot(secret, remove); !changed || done || err != nil {
+		t.Fatalf("runOneShot() returned %v, %v, %v, expected the removal to be assigned", changed, done, err)
+	}
+	if node := secretNode(t, secret); node.Plan.Instructions[0].Name != remove.Name {
+		t.Errorf("assigned %s, expected %s", node.Plan.Instructions[0].Name, remove.Name)
+	}
+}
@@ -0,0 +1,222 @@
+package planner
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/rancher/wrangler/pkg/condition"
+	"github.com/rancher/wrangler/pkg/randomtoken"
+	"k8s.io/apimachinery/pkg/util/version"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+)
+
+const (
+	TokenRotationPhaseServers  = "RotateServers"
+	TokenRotationPhaseAgents   = "RotateAgents"
+	TokenRotationPhaseFinished = "Finished"
+
+	serverTokenKey        = "serverToken"
+	agentTokenKey         = "agentToken"
+	pendingServerTokenKey = "pendingServerToken"
+	pendingAgentTokenKey  = "pendingAgentToken"
+	// generation of the rotation the pending tokens, or once promoted the current tokens, belong to
+	tokenRotationGenerationKey = "tokenRotationGeneration"
+
+	tokenRotateInstructionName = "token-rotate"
+
+	TokensRotated = condition.Cond("TokensRotated")
+)
+
+var (
+	// the token rotate subcommand is available as of rke2 and k3s v1.28
+	minTokenRotationVersion = version.MustParseGeneric("v1.28.0")
+)
+
+func tokenRotationGeneration(controlPlane *rkev1.RKEControlPlane) int {
+	if controlPlane.Spec.RotateTokens == nil {
+		return 0
+	}
+	return controlPlane.Spec.RotateTokens.Generation
+}
+
+func tokenRotationRequested(controlPlane *rkev1.RKEControlPlane, status rkev1.RKEControlPlaneStatus) bool {
+	return tokenRotationGeneration(controlPlane) != status.TokenRotationGeneration
+}
+
+// validateTokenRotation rejects token rotation for runtime versions without the token rotate subcommand.
+func validateTokenRotation(controlPlane *rkev1.RKEControlPlane) error {
+	kubernetesVersion := controlPlane.Spec.KubernetesVersion
+	v, err := version.ParseGeneric(kubernetesVersion)
+	if err != nil {
+		return fmt.Errorf("invalid kubernetes version %s: %w", kubernetesVersion, err)
+	}
+	if !v.AtLeast(minTokenRotationVersion) {
+		return fmt.Errorf("token rotation requires %s v%s or newer, the cluster runs %s",
+			GetRuntime(kubernetesVersion), minTokenRotationVersion, kubernetesVersion)
+	}
+	return nil
+}
+
+func isServerNotInitNode(machine *capi.Machine) bool {
+	return isServer(machine) && !isInitNode(machine)
+}
+
+// pendingTokens returns the tokens that are being rolled out. They are generated once per rotation and kept in the
+// state secret next to the current tokens, together with the generation of the rotation they belong to, so that a
+// rotation survives restarts of the operator and failed status updates. Once the pending tokens were promoted the
+// current tokens are the tokens of the rotation.
+func (p *Planner) pendingTokens(controlPlane *rkev1.RKEControlPlane) (plan.Secret, error) {
+	secret, err := p.secretCache.Get(controlPlane.Namespace, controlPlane.Status.ClusterStateSecretName)
+	if err != nil {
+		return plan.Secret{}, err
+	}
+
+	generation := strconv.Itoa(tokenRotationGeneration(controlPlane))
+	if string(secret.Data[tokenRotationGenerationKey]) == generation {
+		if len(secret.Data[pendingServerTokenKey]) > 0 && len(secret.Data[pendingAgentTokenKey]) > 0 {
+			return plan.Secret{
+				ServerToken: string(secret.Data[pendingServerTokenKey]),
+				AgentToken:  string(secret.Data[pendingAgentTokenKey]),
+			}, nil
+		}
+		return plan.Secret{
+			ServerToken: string(secret.Data[serverTokenKey]),
+			AgentToken:  string(secret.Data[agentTokenKey]),
+		}, nil
+	}
+
+	serverToken, err := randomtoken.Generate()
+	if err != nil {
+		return plan.Secret{}, err
+	}
+
+	agentToken, err := randomtoken.Generate()
+	if err != nil {
+		return plan.Secret{}, err
+	}
+
+	secret = secret.DeepCopy()
+	secret.Data[pendingServerTokenKey] = []byte(serverToken)
+	secret.Data[pendingAgentTokenKey] = []byte(agentToken)
+	secret.Data[tokenRotationGenerationKey] = []byte(generation)
+	if _, err := p.secretClient.Update(secret); err != nil {
+		return plan.Secret{}, err
+	}
+
+	return plan.Secret{
+		ServerToken: serverToken,
+		AgentToken:  agentToken,
+	}, nil
+}
+
+// promotePendingTokens replaces the current tokens with the pending tokens once every machine uses them. The
+// generation of the rotation is kept, so that the promoted tokens are returned as the pending tokens of the rotation
+// until it is recorded as finished.
+func (p *Planner) promotePendingTokens(controlPlane *rkev1.RKEControlPlane) error {
+	secret, err := p.secretCache.Get(controlPlane.Namespace, controlPlane.Status.ClusterStateSecretName)
+	if err != nil {
+		return err
+	}
+
+	if len(secret.Data[pendingServerTokenKey]) == 0 || len(secret.Data[pendingAgentTokenKey]) == 0 {
+		return nil
+	}
+
+	secret = secret.DeepCopy()
+	secret.Data[serverTokenKey] = secret.Data[pendingServerTokenKey]
+	secret.Data[agentTokenKey] = secret.Data[pendingAgentTokenKey]
+	delete(secret.Data, pendingServerTokenKey)
+	delete(secret.Data, pendingAgentTokenKey)
+	_, err = p.secretClient.Update(secret)
+	return err
+}
+
+func tokenRotateInstruction(controlPlane *rkev1.RKEControlPlane, current, pending plan.Secret) plan.Instruction {
+	return plan.Instruction{
+		Name:    tokenRotateInstructionName + "-" + strconv.Itoa(tokenRotationGeneration(controlPlane)),
+		Command: GetRuntime(controlPlane.Spec.KubernetesVersion),
+		Args:    []string{"token", "rotate", "--token", current.ServerToken, "--new-token", pending.ServerToken},
+	}
+}
+
+// rotateTokens rolls new server and agent tokens out to the cluster. The server token is rotated in the datastore
+// from the init node, after which the remaining servers and finally the agents are updated to use the new tokens.
+func (p *Planner) rotateTokens(controlPlane *rkev1.RKEControlPlane, status rkev1.RKEControlPlaneStatus, secret plan.Secret,
+	clusterPlan *plan.Plan, joinServer string) (rkev1.RKEControlPlaneStatus, error) {
+	pending, err := p.pendingTokens(controlPlane)
+	if err != nil {
+		return status, err
+	}
+
+	switch status.TokenRotationPhase {
+	case TokenRotationPhaseServers:
+		// the datastore must be updated with the current token before the servers restart with the new one, the
+		// rotation runs once as a one-shot plan of the init node
+		initNodes, _ := collect(clusterPlan, isInitNode)
+		for _, entry := range initNodes {
+			if entry.Plan == nil {
+				continue
+			}
+			err := p.runOneShot(entry, "token rotation", tokenRotateInstruction(controlPlane, secret, pending))
+			var errWaiting ErrWaiting
+			if errors.As(err, &errWaiting) {
+				return status, err
+			} else if err != nil {
+				return status, p.reportFailure(controlPlane, &status, TokensRotated, err)
+			}
+		}
+
+		err := p.applyPlans(clusterPlan, isInitNode, 0, "token rotation", "updating tokens on", func(entry planEntry) (plan.NodePlan, error) {
+			return p.desiredPlan(controlPlane, pending, entry, true, joinServer)
+		})
+		if err != nil {
+			return status, err
+		}
+
+		servers, _ := collect(clusterPlan, isServer)
+		concurrency, err := resolveConcurrency(controlPlane.Spec.UpgradeStrategy.ServerConcurrency, len(servers))
+		if err != nil {
+			return status, err
+		}
+
+		err = p.applyPlans(clusterPlan, isServerNotInitNode, concurrency, "token rotation", "updating tokens on",
+			func(entry planEntry) (plan.NodePlan, error) {
+				return p.desiredPlan(controlPlane, pending, entry, false, joinServer)
+			})
+		if err != nil {
+			return status, err
+		}
+
+		status.TokenRotationPhase = TokenRotationPhaseAgents
+		return status, ErrWaiting("rotating tokens of agent nodes")
+	case TokenRotationPhaseAgents:
+		workers, _ := collect(clusterPlan, isOnlyWorker)
+		concurrency, err := resolveConcurrency(controlPlane.Spec.UpgradeStrategy.WorkerConcurrency, len(workers))
+		if err != nil {
+			return status, err
+		}
+
+		err = p.applyPlans(clusterPlan, isOnlyWorker, concurrency, "token rotation", "updating tokens on",
+			func(entry planEntry) (plan.NodePlan, error) {
+				return p.desiredPlan(controlPlane, pending, entry, false, joinServer)
+			})
+		if err != nil {
+			return status, err
+		}
+
+		if err := p.promotePendingTokens(controlPlane); err != nil {
+			return status, err
+		}
+
+		status.TokenRotationPhase = TokenRotationPhaseFinished
+		status.TokenRotationGeneration = tokenRotationGeneration(controlPlane)
+		TokensRotated.SetError(&status, "", nil)
+		return status, ErrWaiting("tokens rotated")
+	default:
+		status.TokenRotationPhase = TokenRotationPhaseServers
+		return status, ErrWaiting("rotating tokens of server nodes")
+	}
+}
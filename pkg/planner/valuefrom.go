@@ -0,0 +1,77 @@
+package planner
+
+import (
+	"fmt"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/wrangler/pkg/data/convert"
+	apierror "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// configValueFrom returns the reference of a config value that is read from a secret.
+func configValueFrom(value interface{}) (*rkev1.ConfigValueFrom, error) {
+	data, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+	if _, ok := data["valueFrom"]; !ok {
+		return nil, nil
+	}
+
+	result := &rkev1.ConfigValueFrom{}
+	if err := convert.ToObj(data, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ConfigSecretReferences returns the names of the secrets referenced by config values of the control plane.
+func ConfigSecretReferences(controlPlane *rkev1.RKEControlPlane) (result []string) {
+	for _, opts := range controlPlane.Spec.Config {
+		for _, value := range opts.Config.Data {
+			ref, err := configValueFrom(value)
+			if err != nil || ref == nil || ref.ValueFrom.SecretKeyRef == nil {
+				continue
+			}
+			result = append(result, ref.ValueFrom.SecretKeyRef.Name)
+		}
+	}
+	return result
+}
+
+// resolveConfigValues replaces the config values that reference a secret with the value of the secret.
+func (p *Planner) resolveConfigValues(controlPlane *rkev1.RKEControlPlane, config map[string]interface{}) error {
+	for key, value := range config {
+		ref, err := configValueFrom(value)
+		if err != nil {
+			return fmt.Errorf("invalid valueFrom of config key %s: %w", key, err)
+		} else if ref == nil {
+			continue
+		}
+
+		secretRef := ref.ValueFrom.SecretKeyRef
+		if secretRef == nil || secretRef.Name == "" || secretRef.Key == "" {
+			return fmt.Errorf("valueFrom of config key %s must reference a secret name and key", key)
+		}
+		optional := secretRef.Optional != nil && *secretRef.Optional
+
+		secret, err := p.secretCache.Get(controlPlane.Namespace, secretRef.Name)
+		if apierror.IsNotFound(err) && optional {
+			delete(config, key)
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		data, ok := secret.Data[secretRef.Key]
+		if !ok {
+			if optional {
+				delete(config, key)
+				continue
+			}
+			return fmt.Errorf("key %s of secret %s referenced by config key %s not found", secretRef.Key, secretRef.Name, key)
+		}
+		config[key] = string(data)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package planner
+
+import (
+	"fmt"
+	"time"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/robfig/cron/v3"
+)
+
+// upgradeWindow returns whether the plans of provisioned machines may be changed at now. If they may not, the time
+// the next maintenance window opens is returned, which is zero if upgrades are paused.
+func upgradeWindow(strategy rkev1.ClusterUpgradeStrategy, now time.Time) (bool, time.Time, error) {
+	if strategy.Paused {
+		return false, time.Time{}, nil
+	}
+
+	if len(strategy.MaintenanceWindows) == 0 {
+		return true, time.Time{}, nil
+	}
+
+	location, err := time.LoadLocation(strategy.MaintenanceWindowTimeZone)
+	if err != nil {
+		return false, time.Time{}, fmt.Errorf("invalid maintenance window time zone: %w", err)
+	}
+	now = now.In(location)
+
+	var next time.Time
+	for _, window := range strategy.MaintenanceWindows {
+		schedule, err := cron.ParseStandard(window.Schedule)
+		if err != nil {
+			return false, time.Time{}, fmt.Errorf("invalid maintenance window schedule %q: %w", window.Schedule, err)
+		}
+
+		duration, err := time.ParseDuration(window.Duration)
+		if err != nil {
+			return false, time.Time{}, fmt.Errorf("invalid maintenance window duration %q: %w", window.Duration, err)
+		}
+
+		// the window is open if it was last opened less than its duration ago
+		if !schedule.Next(now.Add(-duration)).After(now) {
+			return true, time.Time{}, nil
+		}
+
+		if opens := schedule.Next(now); next.IsZero() || opens.Before(next) {
+			next = opens
+		}
+	}
+
+	return false, next, nil
+}
+
+// upgradePendingMessage describes why the plans of provisioned machines are not being changed.
+func upgradePendingMessage(next time.Time) string {
+	if next.IsZero() {
+		return "upgrade pending, upgrades are paused"
+	}
+	return "upgrade pending, waiting for window opening at " + next.Format(time.RFC3339)
+}
@@ -0,0 +1,148 @@
+package planner
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+)
+
+func TestUpgradeWindow(t *testing.T) {
+	saturdays := rkev1.MaintenanceWindow{Schedule: "0 2 * * 6", Duration: "4h"}
+	weekdays := rkev1.MaintenanceWindow{Schedule: "0 22 * * 1-5", Duration: "1h"}
+
+	// 2021-05-01 is a saturday
+	tests := []struct {
+		name         string
+		strategy     rkev1.ClusterUpgradeStrategy
+		now          string
+		expectedOpen bool
+		expectedNext string
+		expectedErr  bool
+	}{
+		{
+			name:         "no windows",
+			now:          "2021-05-01T12:00:00Z",
+			expectedOpen: true,
+		},
+		{
+			name: "paused",
+			strategy: rkev1.ClusterUpgradeStrategy{
+				Paused:             true,
+				MaintenanceWindows: []rkev1.MaintenanceWindow{saturdays},
+			},
+			now: "2021-05-01T03:00:00Z",
+		},
+		{
+			name:         "opening",
+			strategy:     rkev1.ClusterUpgradeStrategy{MaintenanceWindows: []rkev1.MaintenanceWindow{saturdays}},
+			now:          "2021-05-01T02:00:00Z",
+			expectedOpen: true,
+		},
+		{
+			name:         "open",
+			strategy:     rkev1.ClusterUpgradeStrategy{MaintenanceWindows: []rkev1.MaintenanceWindow{saturdays}},
+			now:          "2021-05-01T05:59:59Z",
+			expectedOpen: true,
+		},
+		{
+			name:         "closing",
+			strategy:     rkev1.ClusterUpgradeStrategy{MaintenanceWindows: []rkev1.MaintenanceWindow{saturdays}},
+			now:          "2021-05-01T06:00:00Z",
+			expectedNext: "2021-05-08T02:00:00Z",
+		},
+		{
+			name:         "before opening",
+			strategy:     rkev1.ClusterUpgradeStrategy{MaintenanceWindows: []rkev1.MaintenanceWindow{saturdays}},
+			now:          "2021-04-30T12:00:00Z",
+			expectedNext: "2021-05-01T02:00:00Z",
+		},
+		{
+			name:         "earliest of several windows",
+			strategy:     rkev1.ClusterUpgradeStrategy{MaintenanceWindows: []rkev1.MaintenanceWindow{saturdays, weekdays}},
+			now:          "2021-04-29T12:00:00Z",
+			expectedNext: "2021-04-29T22:00:00Z",
+		},
+		{
+			name:         "any of several windows open",
+			strategy:     rkev1.ClusterUpgradeStrategy{MaintenanceWindows: []rkev1.MaintenanceWindow{saturdays, weekdays}},
+			now:          "2021-04-30T22:30:00Z",
+			expectedOpen: true,
+		},
+		{
+			name: "time zone",
+			strategy: rkev1.ClusterUpgradeStrategy{
+				MaintenanceWindows:        []rkev1.MaintenanceWindow{saturdays},
+				MaintenanceWindowTimeZone: "Europe/Berlin",
+			},
+			// 02:30 in Berlin
+			now:          "2021-05-01T00:30:00Z",
+			expectedOpen: true,
+		},
+		{
+			name: "next opening in time zone",
+			strategy: rkev1.ClusterUpgradeStrategy{
+				MaintenanceWindows:        []rkev1.MaintenanceWindow{saturdays},
+				MaintenanceWindowTimeZone: "Europe/Berlin",
+			},
+			now:          "2021-05-01T04:00:00Z",
+			expectedNext: "2021-05-08T00:00:00Z",
+		},
+		{
+			name: "invalid schedule",
+			strategy: rkev1.ClusterUpgradeStrategy{
+				MaintenanceWindows: []rkev1.MaintenanceWindow{{Schedule: "every saturday", Duration: "4h"}},
+			},
+			now:         "2021-05-01T03:00:00Z",
+			expectedErr: true,
+		},
+		{
+			name: "invalid duration",
+			strategy: rkev1.ClusterUpgradeStrategy{
+				MaintenanceWindows: []rkev1.MaintenanceWindow{{Schedule: "0 2 * * 6", Duration: "4 hours"}},
+			},
+			now:         "2021-05-01T03:00:00Z",
+			expectedErr: true,
+		},
+		{
+			name: "invalid time zone",
+			strategy: rkev1.ClusterUpgradeStrategy{
+				MaintenanceWindows:        []rkev1.MaintenanceWindow{saturdays},
+				MaintenanceWindowTimeZone: "Mars/Olympus_Mons",
+			},
+			now:         "2021-05-01T03:00:00Z",
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			now, err := time.Parse(time.RFC3339, test.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			open, next, err := upgradeWindow(test.strategy, now)
+			if test.expectedErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if open != test.expectedOpen {
+				t.Errorf("upgradeWindow() open = %v, expected %v", open, test.expectedOpen)
+			}
+			if test.expectedNext == "" {
+				if !next.IsZero() {
+					t.Errorf("upgradeWindow() next = %v, expected none", next)
+				}
+			} else if expected, _ := time.Parse(time.RFC3339, test.expectedNext); !next.Equal(expected) {
+				t.Errorf("upgradeWindow() next = %v, expected %v", next, expected)
+			}
+		})
+	}
+}
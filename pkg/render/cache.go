@@ -0,0 +1,151 @@
+package render
+
+import (
+	mgmtcontrollers "github.com/rancher/rancher-operator/pkg/generated/controllers/management.cattle.io/v3"
+	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	corecontrollers "github.com/rancher/wrangler/pkg/generated/controllers/core/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierror "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// secretCache serves the secrets read from the input files
+type secretCache struct {
+	secrets  map[string]*corev1.Secret
+	indexers map[string]corecontrollers.SecretIndexer
+}
+
+func (s *secretCache) Get(namespace, name string) (*corev1.Secret, error) {
+	secret, ok := s.secrets[namespace+"/"+name]
+	if !ok {
+		return nil, apierror.NewNotFound(corev1.Resource("secrets"), name)
+	}
+	return secret, nil
+}
+
+func (s *secretCache) List(namespace string, selector labels.Selector) (result []*corev1.Secret, _ error) {
+	for _, secret := range s.secrets {
+		if (namespace == "" || secret.Namespace == namespace) && selector.Matches(labels.Set(secret.Labels)) {
+			result = append(result, secret)
+		}
+	}
+	return result, nil
+}
+
+func (s *secretCache) AddIndexer(indexName string, indexer corecontrollers.SecretIndexer) {
+	s.indexers[indexName] = indexer
+}
+
+func (s *secretCache) GetByIndex(indexName, key string) (result []*corev1.Secret, _ error) {
+	indexer, ok := s.indexers[indexName]
+	if !ok {
+		return nil, nil
+	}
+	for _, secret := range s.secrets {
+		keys, err := indexer(secret)
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range keys {
+			if k == key {
+				result = append(result, secret)
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// settingCache serves the settings read from the input files. Settings that are not provided are returned
+// empty, as they would be on a rancher installation where they were never changed.
+type settingCache struct {
+	settings map[string]*v3.Setting
+}
+
+func (s *settingCache) Get(name string) (*v3.Setting, error) {
+	if setting, ok := s.settings[name]; ok {
+		return setting, nil
+	}
+	setting := &v3.Setting{}
+	setting.Name = name
+	return setting, nil
+}
+
+func (s *settingCache) List(selector labels.Selector) (result []*v3.Setting, _ error) {
+	for _, setting := range s.settings {
+		if selector.Matches(labels.Set(setting.Labels)) {
+			result = append(result, setting)
+		}
+	}
+	return result, nil
+}
+
+func (s *settingCache) AddIndexer(indexName string, indexer mgmtcontrollers.SettingIndexer) {
+}
+
+func (s *settingCache) GetByIndex(indexName, key string) ([]*v3.Setting, error) {
+	return nil, nil
+}
+
+// dynamicSchemaCache has no schemas, so node configs are used as they are
+type dynamicSchemaCache struct{}
+
+func (dynamicSchemaCache) Get(name string) (*v3.DynamicSchema, error) {
+	return nil, apierror.NewNotFound(v3.Resource("dynamicschemas"), name)
+}
+
+func (dynamicSchemaCache) List(selector labels.Selector) ([]*v3.DynamicSchema, error) {
+	return nil, nil
+}
+
+func (dynamicSchemaCache) AddIndexer(indexName string, indexer mgmtcontrollers.DynamicSchemaIndexer) {
+}
+
+func (dynamicSchemaCache) GetByIndex(indexName, key string) ([]*v3.DynamicSchema, error) {
+	return nil, nil
+}
+
+// nodeConfigs serves the objects from the input files that are not of a known type
+type nodeConfigs map[schema.GroupVersionKind]map[string]runtime.Object
+
+func (n nodeConfigs) Get(gvk schema.GroupVersionKind, namespace, name string) (runtime.Object, error) {
+	obj, ok := n[gvk][namespace+"/"+name]
+	if !ok {
+		return nil, apierror.NewNotFound(schema.GroupResource{
+			Group:    gvk.Group,
+			Resource: gvk.Kind,
+		}, name)
+	}
+	return obj, nil
+}
+
+// configMapCache serves the config maps read from the input files
+type configMapCache struct {
+	configMaps map[string]*corev1.ConfigMap
+}
+
+func (c *configMapCache) Get(namespace, name string) (*corev1.ConfigMap, error) {
+	configMap, ok := c.configMaps[namespace+"/"+name]
+	if !ok {
+		return nil, apierror.NewNotFound(corev1.Resource("configmaps"), name)
+	}
+	return configMap, nil
+}
+
+func (c *configMapCache) List(namespace string, selector labels.Selector) (result []*corev1.ConfigMap, _ error) {
+	for _, configMap := range c.configMaps {
+		if (namespace == "" || configMap.Namespace == namespace) && selector.Matches(labels.Set(configMap.Labels)) {
+			result = append(result, configMap)
+		}
+	}
+	return result, nil
+}
+
+func (c *configMapCache) AddIndexer(indexName string, indexer corecontrollers.ConfigMapIndexer) {
+}
+
+func (c *configMapCache) GetByIndex(indexName, key string) ([]*corev1.ConfigMap, error) {
+	return nil, nil
+}
@@ -0,0 +1,245 @@
+// Package render evaluates the provisioning of a rancher cluster from local files, without an API server, so that
+// the generated objects and node plans can be reviewed before they are applied.
+package render
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	rancherv1 "github.com/rancher/rancher-operator/pkg/apis/rancher.cattle.io/v1"
+	rkev1 "github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher-operator/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/rancher/rancher-operator/pkg/controllers/rke/ranchercluster"
+	"github.com/rancher/rancher-operator/pkg/planner"
+	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	corecontrollers "github.com/rancher/wrangler/pkg/generated/controllers/core/v1"
+	"github.com/rancher/wrangler/pkg/yaml"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	capi "sigs.k8s.io/cluster-api/api/v1alpha4"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+type input struct {
+	cluster     *rancherv1.Cluster
+	machines    []*capi.Machine
+	secrets     *secretCache
+	configMaps  *configMapCache
+	settings    *settingCache
+	nodeConfigs nodeConfigs
+}
+
+type renderedPlan struct {
+	Machine      string                `json:"machine"`
+	Files        []renderedFile        `json:"files,omitempty"`
+	Instructions []plan.Instruction    `json:"instructions,omitempty"`
+	Probes       map[string]plan.Probe `json:"probes,omitempty"`
+}
+
+type renderedFile struct {
+	Path        string `json:"path,omitempty"`
+	Permissions string `json:"permissions,omitempty"`
+	Owner       string `json:"owner,omitempty"`
+	Group       string `json:"group,omitempty"`
+	Delete      bool   `json:"delete,omitempty"`
+	Content     string `json:"content,omitempty"`
+}
+
+// Render reads a rancher Cluster and the Machines, Settings, Secrets, ConfigMaps and node configs it refers to from the given
+// files and writes the generated objects followed by the decoded plan of every machine to out.
+func Render(ctx context.Context, files []string, out io.Writer) error {
+	in, err := readInput(files)
+	if err != nil {
+		return err
+	}
+
+	if in.cluster.Spec.RKEConfig == nil {
+		return fmt.Errorf("cluster %s/%s has no rkeConfig", in.cluster.Namespace, in.cluster.Name)
+	}
+
+	objs, err := ranchercluster.Objects(in.cluster, in.nodeConfigs, dynamicSchemaCache{})
+	if err != nil {
+		return err
+	}
+
+	var controlPlane *rkev1.RKEControlPlane
+	for _, obj := range objs {
+		if cp, ok := obj.(*rkev1.RKEControlPlane); ok {
+			controlPlane = cp
+		}
+	}
+
+	plans, err := planner.Render(ctx, controlPlane, in.machines, in.secrets, in.configMaps, in.settings)
+	if err != nil {
+		return err
+	}
+
+	data, err := yaml.Export(objs...)
+	if err != nil {
+		return err
+	}
+	if _, err := out.Write(data); err != nil {
+		return err
+	}
+
+	var names []string
+	for name := range plans {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		rendered, err := decodePlan(name, plans[name])
+		if err != nil {
+			return err
+		}
+		data, err := sigsyaml.Marshal(rendered)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(out, "\n---\n%s", data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func decodePlan(machineName string, nodePlan plan.NodePlan) (renderedPlan, error) {
+	result := renderedPlan{
+		Machine:      machineName,
+		Instructions: nodePlan.Instructions,
+		Probes:       nodePlan.Probes,
+	}
+
+	for _, file := range nodePlan.Files {
+		content, err := base64.StdEncoding.DecodeString(file.Content)
+		if err != nil {
+			return result, fmt.Errorf("decoding %s of machine %s: %w", file.Path, machineName, err)
+		}
+		result.Files = append(result.Files, renderedFile{
+			Path:        file.Path,
+			Permissions: file.Permissions,
+			Owner:       file.Owner,
+			Group:       file.Group,
+			Delete:      file.Delete,
+			Content:     string(content),
+		})
+	}
+
+	return result, nil
+}
+
+func readInput(files []string) (*input, error) {
+	in := &input{
+		secrets: &secretCache{
+			secrets:  map[string]*corev1.Secret{},
+			indexers: map[string]corecontrollers.SecretIndexer{},
+		},
+		configMaps: &configMapCache{
+			configMaps: map[string]*corev1.ConfigMap{},
+		},
+		settings: &settingCache{
+			settings: map[string]*v3.Setting{},
+		},
+		nodeConfigs: nodeConfigs{},
+	}
+
+	for _, file := range files {
+		if err := in.readFile(file); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", file, err)
+		}
+	}
+
+	if in.cluster == nil {
+		return nil, fmt.Errorf("no rancher.cattle.io/v1 Cluster found in %v", files)
+	}
+
+	return in, nil
+}
+
+func (in *input) readFile(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	objs, err := yaml.ToObjects(f)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objs {
+		if err := in.add(obj.(*unstructured.Unstructured)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (in *input) add(obj *unstructured.Unstructured) error {
+	gvk := obj.GroupVersionKind()
+	switch gvk {
+	case rancherv1.SchemeGroupVersion.WithKind("Cluster"):
+		if in.cluster != nil {
+			return fmt.Errorf("only one Cluster can be rendered, found %s and %s", in.cluster.Name, obj.GetName())
+		}
+		in.cluster = &rancherv1.Cluster{}
+		return fromUnstructured(obj, in.cluster)
+	case capi.GroupVersion.WithKind("Machine"):
+		machine := &capi.Machine{}
+		if err := fromUnstructured(obj, machine); err != nil {
+			return err
+		}
+		in.machines = append(in.machines, machine)
+	case v3.SchemeGroupVersion.WithKind("Setting"):
+		setting := &v3.Setting{}
+		if err := fromUnstructured(obj, setting); err != nil {
+			return err
+		}
+		in.settings.settings[setting.Name] = setting
+	case corev1.SchemeGroupVersion.WithKind("Secret"):
+		secret := &corev1.Secret{}
+		if err := fromUnstructured(obj, secret); err != nil {
+			return err
+		}
+		// stringData is merged by the API server on write, do the same for secrets written by hand
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		for k, v := range secret.StringData {
+			secret.Data[k] = []byte(v)
+		}
+		in.secrets.secrets[secret.Namespace+"/"+secret.Name] = secret
+	case corev1.SchemeGroupVersion.WithKind("ConfigMap"):
+		configMap := &corev1.ConfigMap{}
+		if err := fromUnstructured(obj, configMap); err != nil {
+			return err
+		}
+		in.configMaps.configMaps[configMap.Namespace+"/"+configMap.Name] = configMap
+	default:
+		if in.nodeConfigs[gvk] == nil {
+			in.nodeConfigs[gvk] = map[string]runtime.Object{}
+		}
+		in.nodeConfigs[gvk][obj.GetNamespace()+"/"+obj.GetName()] = obj
+	}
+	return nil
+}
+
+// fromUnstructured decodes through JSON rather than the unstructured converter because the converter doesn't
+// inline embedded structs without a json tag, such as the RKEClusterSpecCommon of the RKE config.
+func fromUnstructured(obj *unstructured.Unstructured, target interface{}) error {
+	data, err := obj.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
@@ -58,6 +58,27 @@ func Get(settings mgmtcontrollers.SettingCache, key string) (string, error) {
 	return server.Value, nil
 }
 
+// GetList returns the comma separated values of a setting, or def if the setting does not exist or is empty
+func GetList(settings mgmtcontrollers.SettingCache, key string, def []string) ([]string, error) {
+	val, err := Get(settings, key)
+	if apierror.IsNotFound(err) {
+		return def, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var result []string
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	if len(result) == 0 {
+		return def, nil
+	}
+	return result, nil
+}
+
 func GetServerURLAndCAChecksum(settings mgmtcontrollers.SettingCache) (string, string, error) {
 	url, ca, err := GetServerURLAndCA(settings)
 	if err != nil {